@@ -5,16 +5,39 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // RawBoondoggle is the struct representation of the boondoggle.yml config file.
 type RawBoondoggle struct {
 	HelmVersion     int    `mapstructure:"helmVersion,omitempty"`
+	HelmBackend     string `mapstructure:"helmBackend,omitempty"`
+	MergeValues     bool   `mapstructure:"mergeValues,omitempty"`
 	PullSecretsName string `mapstructure:"pull-secrets-name,omitempty"`
 	DockerUsername  string `mapstructure:"docker_username,omitempty"`
 	DockerPassword  string `mapstructure:"docker_password,omitempty"`
 	DockerEmail     string `mapstructure:"docker_email,omitempty"`
-	HelmRepos       []struct {
+	DockerServer    string `mapstructure:"docker_server,omitempty"`
+	// DockerRegistries are more registries in the pull secret, next to the one of docker_server.
+	// Deprecated: they are an alias of pull-secrets entries named after pull-secrets-name.
+	DockerRegistries []struct {
+		Server   string `mapstructure:"server"`
+		Username string `mapstructure:"username,omitempty"`
+		Password string `mapstructure:"password,omitempty"`
+		Email    string `mapstructure:"email,omitempty"`
+	} `mapstructure:"docker_registries,omitempty"`
+	// PullSecretsPatchServiceAccount adds the pull-secrets-name secret to the default service account.
+	PullSecretsPatchServiceAccount bool `mapstructure:"pull-secrets-patch-service-account,omitempty"`
+	// PullSecrets are more image pull secrets. Entries with the same name are the registries of one secret.
+	PullSecrets []struct {
+		Name                string `mapstructure:"name"`
+		Server              string `mapstructure:"server"`
+		Username            string `mapstructure:"username,omitempty"`
+		Password            string `mapstructure:"password,omitempty"`
+		Email               string `mapstructure:"email,omitempty"`
+		PatchServiceAccount bool   `mapstructure:"patch-service-account,omitempty"`
+	} `mapstructure:"pull-secrets,omitempty"`
+	HelmRepos []struct {
 		Name            string `mapstructure:"name"`
 		URL             string `mapstructure:"url"`
 		Promptbasicauth bool   `mapstructure:"promptbasicauth,omitempty"`
@@ -22,15 +45,10 @@ type RawBoondoggle struct {
 		Password        string `mapstructure:"password,omitempty"`
 	} `mapstructure:"helm-repos"`
 	Umbrella struct {
-		Name         string `mapstructure:"name"`
-		Repository   string `mapstructure:"repository"`
-		Path         string `mapstructure:"path"`
-		Environments []struct {
-			Name           string   `mapstructure:"name"`
-			Files          []string `mapstructure:"files,omitempty"`
-			Values         []string `mapstructure:"values,omitempty"`
-			AddtlHelmFlags []string `mapstructure:"addtlHelmFlags,omitempty"`
-		} `mapstructure:"environments"`
+		Name         string                `mapstructure:"name"`
+		Repository   string                `mapstructure:"repository"`
+		Path         string                `mapstructure:"path"`
+		Environments []UmbrellaEnvironment `mapstructure:"environments"`
 	} `mapstructure:"umbrella"`
 	Services []struct {
 		Name               string `mapstructure:"name"`
@@ -46,21 +64,31 @@ type RawBoondoggle struct {
 		} `mapstructure:"dep-values-all-states,omitempty"`
 		States []struct {
 			StateName      string        `mapstructure:"state-name"`
-			ContainerBuild string        `mapstructure:"container-build,omitempty"`
+			GitRef         string        `mapstructure:"gitref,omitempty"`
+			ContainerBuild Args          `mapstructure:"container-build,omitempty"`
 			Repository     string        `mapstructure:"repository"`
-			HelmValues     []string      `mapstructure:"helm-values,omitempty"`
+			HelmValues     []HelmValue   `mapstructure:"helm-values,omitempty"`
+			ValuesFiles    []string      `mapstructure:"values-files,omitempty"`
 			Version        string        `mapstructure:"version"`
 			Condition      string        `mapstructure:"condition,omitempty"`
 			Tags           []string      `mapstructure:"tags,omitempty"`
 			Enabled        bool          `mapstructure:"enabled,omitempty"`
 			Importvalues   []interface{} `mapstructure:"importvalues,omitempty"`
 			PreDeploySteps []struct {
-				Cmd  string   `mapstructure:"cmd,omitempty"`
-				Args []string `mapstructure:"args,omitempty"`
+				Cmd             string        `mapstructure:"cmd,omitempty"`
+				Args            []string      `mapstructure:"args,omitempty"`
+				ContinueOnError bool          `mapstructure:"continueOnError,omitempty"`
+				Timeout         time.Duration `mapstructure:"timeout,omitempty"`
+				Workdir         string        `mapstructure:"workdir,omitempty"`
+				Env             []string      `mapstructure:"env,omitempty"`
 			} `mapstructure:"preDeploySteps,omitempty"`
 			PostDeploySteps []struct {
-				Cmd  string   `mapstructure:"cmd,omitempty"`
-				Args []string `mapstructure:"args,omitempty"`
+				Cmd             string        `mapstructure:"cmd,omitempty"`
+				Args            []string      `mapstructure:"args,omitempty"`
+				ContinueOnError bool          `mapstructure:"continueOnError,omitempty"`
+				Timeout         time.Duration `mapstructure:"timeout,omitempty"`
+				Workdir         string        `mapstructure:"workdir,omitempty"`
+				Env             []string      `mapstructure:"env,omitempty"`
 			} `mapstructure:"postDeploySteps,omitempty"`
 			PostDeployExec []struct {
 				App       string   `mapstructure:"app,omitempty"`
@@ -69,6 +97,10 @@ type RawBoondoggle struct {
 			} `mapstructure:"postDeployExec,omitempty"`
 		} `mapstructure:"states"`
 	} `mapstructure:"services"`
+	// Profiles maps a profile name to the state of each service in it. The "env" key selects the umbrella environment.
+	Profiles map[string]map[string]string `mapstructure:"profiles,omitempty"`
+	// UnknownKeys are the keys of the config that do not match a setting. It is filled by UnmarshalConfig.
+	UnknownKeys []string `mapstructure:"-"`
 }
 
 type LogPrinter interface {
@@ -81,14 +113,27 @@ type Boondoggle struct {
 	DockerUsername  string
 	DockerPassword  string
 	DockerEmail     string
+	DockerServer    string
+	ExtraRegistries []RegistryCredential // added to the pull secret next to the Docker* credentials
+	PatchDefaultSA  bool                 // add the pull secret to the default service account
+	PullSecrets     []PullSecret         // the pull-secrets list, next to the PullSecretsName secret
 	HelmVersion     int
+	HelmBackend     string
+	MergeValues     bool // pass the values of the services and the --set values as one values file
 	HelmRepos       []HelmRepo
 	Umbrella        Umbrella
 	Services        []Service
 	ExtraEnv        map[string]string
+	Lock            Lock // the versions pinned by boondoggle.lock, see LoadLock
 	L               LogPrinter
+	R               Runner
+	P               Prompter       // asks for the credentials missing from boondoggle.yml
+	Secrets         SecretResolver // resolves the secret references in the credentials, DefaultSecretResolver when nil
 	Verbose         bool
 	SuperSecret     bool
+	envRefs         map[string][]string // the environment variables each config key refers to
+	redact          []string            // the secrets to leave out of the verbose output
+	usedEnv         map[string]string   // the environment variables replaced in boondoggle.yml, see UsedEnv
 }
 
 // HelmRepo is the data needed to add a Helm Repository. Part of Boondoggle struct.
@@ -112,22 +157,29 @@ type Umbrella struct {
 
 // Step contains instructions for a pre, post or post exec build step for local.
 type Step struct {
-	App       string
-	Container string
-	Cmd       string
-	Args      []string
+	App             string
+	Container       string
+	Cmd             string
+	Args            []string
+	ContinueOnError bool
+	Timeout         time.Duration
+	Workdir         string
+	Env             []string
 }
 
 // Service is the definition of a service (an umbrella dependency). Part of Boondoggle struct.
 type Service struct {
 	Name            string
+	State           string
 	Path            string
 	Gitrepo         string
+	GitRef          string
 	Alias           string
 	Chart           string
-	ContainerBuild  string
+	ContainerBuild  []string
 	Repository      string
-	HelmValues      []string
+	HelmValues      []HelmValue
+	ValuesFiles     []string
 	Version         string
 	Condition       string
 	Tags            []string
@@ -139,19 +191,35 @@ type Service struct {
 }
 
 // NewBoondoggle unmarshals the boondoggle.yml to RawBoondoggle and returns a processed Boondoggle struct type.
-func NewBoondoggle(config RawBoondoggle, environment string, setStateAll string, serviceState []string, extraEnv map[string]string, logger LogPrinter, verbose bool, superSecret bool) Boondoggle {
+// The service states and environment of profile are used when they are not given by serviceState or environment.
+// If the config or the flags have problems, the returned error is a ConfigErrors listing every one of them.
+func NewBoondoggle(config RawBoondoggle, environment string, profile string, setStateAll string, serviceState []string, extraEnv map[string]string, logger LogPrinter, verbose bool, superSecret bool) (Boondoggle, error) {
 	var boondoggle Boondoggle
 	boondoggle.ExtraEnv = extraEnv
 	boondoggle.L = logger
+	boondoggle.R = ExecRunner{}
+	boondoggle.P = TerminalPrompter{}
 	boondoggle.Verbose = verbose
 	boondoggle.SuperSecret = superSecret
 	if superSecret {
 		boondoggle.Verbose = true
 	}
-	boondoggle.configureServices(config, setStateAll, serviceState)
-	boondoggle.configureUmbrella(config, environment)
+	errs := checkConfig(config)
+	errs = append(errs, checkNameValueFlags("service-state", serviceState)...)
+	profileStates, profileEnv, profileErrs := resolveProfile(config, profile)
+	errs = append(errs, profileErrs...)
+	if environment == "" {
+		environment = profileEnv
+	}
+	errs = append(errs, boondoggle.configureServices(config, setStateAll, serviceState, profileStates)...)
+	errs = append(errs, boondoggle.configureUmbrella(config, environment)...)
+	errs = append(errs, boondoggle.checkLocalPaths(config)...)
 	boondoggle.configureTopLevel(config)
-	return boondoggle
+	errs = append(errs, boondoggle.checkHelmBackend()...)
+	if len(errs) > 0 {
+		return boondoggle, errs
+	}
+	return boondoggle, nil
 }
 
 // GetHelmDepName is a helper to return the Alias if there is one, else returns Chart
@@ -164,67 +232,182 @@ func (s Service) GetHelmDepName() string {
 
 func (b *Boondoggle) configureTopLevel(r RawBoondoggle) {
 	b.PullSecretsName = r.PullSecretsName
-	b.DockerEmail = b.escapableEnvVarReplace(r.DockerEmail)
-	b.DockerPassword = b.escapableEnvVarReplace(r.DockerPassword)
-	b.DockerUsername = b.escapableEnvVarReplace(r.DockerUsername)
+	b.DockerEmail = b.configValue("docker_email", r.DockerEmail)
+	b.DockerPassword = b.configValue("docker_password", r.DockerPassword)
+	b.DockerUsername = b.configValue("docker_username", r.DockerUsername)
+	b.DockerServer = b.configValue("docker_server", r.DockerServer)
+	if len(r.DockerRegistries) > 0 {
+		b.L.Print(Format(Yellow, "docker_registries is deprecated, use pull-secrets entries named after pull-secrets-name instead."))
+	}
+	for _, registry := range r.DockerRegistries {
+		prefix := fmt.Sprintf("docker_registries[%s].", registry.Server)
+		b.ExtraRegistries = append(b.ExtraRegistries, RegistryCredential{
+			Server:    b.escapableEnvVarReplace(registry.Server),
+			Username:  b.configValue(prefix+"username", registry.Username),
+			Password:  b.configValue(prefix+"password", registry.Password),
+			Email:     b.configValue(prefix+"email", registry.Email),
+			KeyPrefix: prefix,
+		})
+	}
+	b.PatchDefaultSA = r.PullSecretsPatchServiceAccount
+	for i, rawSecret := range r.PullSecrets {
+		prefix := fmt.Sprintf("pull-secrets[%d].", i)
+		registry := RegistryCredential{
+			Server:    b.escapableEnvVarReplace(rawSecret.Server),
+			Username:  b.configValue(prefix+"username", rawSecret.Username),
+			Password:  b.configValue(prefix+"password", rawSecret.Password),
+			Email:     b.configValue(prefix+"email", rawSecret.Email),
+			KeyPrefix: prefix,
+		}
+		// Entries named after pull-secrets-name are the same as docker_registries, and replace the docker_registries
+		// entry of the same server.
+		if b.PullSecretsName != "" && rawSecret.Name == b.PullSecretsName {
+			replaced := false
+			for j := range b.ExtraRegistries {
+				if b.ExtraRegistries[j].Server == registry.Server {
+					b.ExtraRegistries[j] = registry
+					replaced = true
+				}
+			}
+			if !replaced {
+				b.ExtraRegistries = append(b.ExtraRegistries, registry)
+			}
+			b.PatchDefaultSA = b.PatchDefaultSA || rawSecret.PatchServiceAccount
+			continue
+		}
+		added := false
+		for j := range b.PullSecrets {
+			if b.PullSecrets[j].Name == rawSecret.Name {
+				b.PullSecrets[j].Registries = append(b.PullSecrets[j].Registries, registry)
+				b.PullSecrets[j].PatchServiceAccount = b.PullSecrets[j].PatchServiceAccount || rawSecret.PatchServiceAccount
+				added = true
+			}
+		}
+		if !added {
+			b.PullSecrets = append(b.PullSecrets, PullSecret{Name: rawSecret.Name, Registries: []RegistryCredential{registry}, PatchServiceAccount: rawSecret.PatchServiceAccount})
+		}
+	}
 	if r.HelmVersion == 0 {
 		b.HelmVersion = 2
 	} else {
 		b.HelmVersion = r.HelmVersion
 	}
+	if r.HelmBackend == "" {
+		b.HelmBackend = HelmBackendCLI
+	} else {
+		b.HelmBackend = r.HelmBackend
+	}
+	b.MergeValues = r.MergeValues
 	for _, helmrepo := range r.HelmRepos {
 		var repoDetails = HelmRepo{
 			Name:            helmrepo.Name,
 			URL:             helmrepo.URL,
 			Promptbasicauth: helmrepo.Promptbasicauth,
-			Username:        b.escapableEnvVarReplace(helmrepo.Username),
-			Password:        b.escapableEnvVarReplace(helmrepo.Password),
+			Username:        b.configValue(helmRepoKey(helmrepo.Name, "username"), helmrepo.Username),
+			Password:        b.configValue(helmRepoKey(helmrepo.Name, "password"), helmrepo.Password),
 		}
 		b.HelmRepos = append(b.HelmRepos, repoDetails)
 	}
 }
 
 // converts RawBoondoggle into the umbrella configurations for Boondoggle
-func (b *Boondoggle) configureUmbrella(r RawBoondoggle, environment string) {
+func (b *Boondoggle) configureUmbrella(r RawBoondoggle, environment string) ConfigErrors {
 	umbrellaEnv := environment
-	var umbrellaEnvKey int
-	var err error
 	// get the environments slice that matches the requested environment, or default if nothing is provided.
-	if umbrellaEnv != "" {
-		umbrellaEnvKey, err = getRawUmbrellaEnvkeyByName(umbrellaEnv, r)
-	} else {
-		umbrellaEnvKey, err = getRawUmbrellaEnvkeyByName("default", r)
+	if umbrellaEnv == "" {
+		umbrellaEnv = "default"
+	}
+	env, err := ResolveUmbrellaEnvironment(umbrellaEnv, r)
+	if _, ok := err.(extendsError); ok {
+		// checkConfig reports the broken extends of every environment
+		return nil
 	}
-
 	if err != nil {
 		// indicates there was not a match for the given environment
-		b.L.Print(err)
-	} else {
-		// build the environment in Boondoggle
-		b.Umbrella.Name = r.Umbrella.Name
-		b.Umbrella.Path, _ = filepath.Abs(r.Umbrella.Path)
-		b.Umbrella.Repository = r.Umbrella.Repository
-		b.Umbrella.Values = b.escapableEnvVarReplaceSlice(r.Umbrella.Environments[umbrellaEnvKey].Values)
-		b.Umbrella.Files = r.Umbrella.Environments[umbrellaEnvKey].Files
-		b.Umbrella.AddtlHelmFlags = r.Umbrella.Environments[umbrellaEnvKey].AddtlHelmFlags
+		return ConfigErrors{{Path: "umbrella.environments", Message: err.Error()}}
 	}
+
+	// build the environment in Boondoggle
+	b.Umbrella.Name = r.Umbrella.Name
+	b.Umbrella.Path, _ = filepath.Abs(r.Umbrella.Path)
+	b.Umbrella.Repository = r.Umbrella.Repository
+	b.Umbrella.Values = b.escapableEnvVarReplaceSlice(env.Values)
+	b.Umbrella.Files = env.Files
+	b.Umbrella.AddtlHelmFlags = env.AddtlHelmFlags
+	return nil
 }
 
-func getRawUmbrellaEnvkeyByName(desiredEnvName string, r RawBoondoggle) (int, error) {
-	for key, env := range r.Umbrella.Environments {
-		if env.Name == desiredEnvName {
-			return key, nil
+// getRawUmbrellaEnvkeyByName returns the key of the named environment, after the keys of the environments it extends,
+// the furthest first. A chain of extends that is broken or goes round in a cycle returns an extendsError.
+func getRawUmbrellaEnvkeyByName(desiredEnvName string, r RawBoondoggle) ([]int, error) {
+	var keys []int
+	var chain []string
+	name := desiredEnvName
+	for name != "" {
+		for i, seen := range chain {
+			if seen == name {
+				cycle := append(chain[i:], name)
+				return nil, extendsError{Env: cycleOwner(chain[i:], r), Message: fmt.Sprintf("environment %s extends itself: %s", name, strings.Join(cycle, " -> "))}
+			}
 		}
+		key := rawUmbrellaEnvKey(name, r)
+		if key == -1 && len(chain) == 0 {
+			return nil, fmt.Errorf("the environment %s was not found", desiredEnvName)
+		}
+		if key == -1 {
+			parent := chain[len(chain)-1]
+			return nil, extendsError{Env: parent, Message: fmt.Sprintf("environment %s extends unknown environment %s", parent, name)}
+		}
+		chain = append(chain, name)
+		keys = append([]int{key}, keys...)
+		name = r.Umbrella.Environments[key].Extends
 	}
-	return 999, fmt.Errorf("the specified environment was not found")
+	return keys, nil
+}
+
+// ProfileEnvKey is the key of a profile that selects the umbrella environment instead of a service state.
+const ProfileEnvKey = "env"
+
+// resolveProfile returns the service states and the environment of the named profile.
+// viper lower-cases the keys of the profile, so they are matched with the service names without case.
+func resolveProfile(r RawBoondoggle, profile string) (map[string]string, string, ConfigErrors) {
+	if profile == "" {
+		return nil, "", nil
+	}
+	rawProfile, ok := r.Profiles[strings.ToLower(profile)]
+	if !ok {
+		return nil, "", ConfigErrors{{Path: "profiles", Message: fmt.Sprintf("the profile %s was not found", profile)}}
+	}
+	states := make(map[string]string)
+	var environment string
+	for name, state := range rawProfile {
+		if name == ProfileEnvKey {
+			environment = state
+			continue
+		}
+		for _, rawService := range r.Services {
+			if strings.EqualFold(rawService.Name, name) {
+				states[rawService.Name] = state
+			}
+		}
+	}
+	// Unknown services in profiles are reported by checkConfig.
+	return states, environment, nil
 }
 
 // Converts a RawBoondoggle into the services for Boondoggle so they can be consumed by the rest of the application.
-func (b *Boondoggle) configureServices(r RawBoondoggle, setStateAll string, serviceState []string) {
+// The state of a service is the --set-state-all flag, else its --service-state flag, else its state in the profile, else "default".
+func (b *Boondoggle) configureServices(r RawBoondoggle, setStateAll string, serviceState []string, profileStates map[string]string) ConfigErrors {
+	var errs ConfigErrors
 	// First get the service-state overrides provided by the user in a way that we can work with.
 	serviceStates := getServiceStatesMap(serviceState)
+	for name := range serviceStates {
+		if rawServiceKey(name, r) == -1 {
+			errs = append(errs, ConfigError{Message: fmt.Sprintf("--service-state names unknown service %s", name)})
+		}
+	}
 	// For each of the services on RawBoondoggle...
-	for _, rawService := range r.Services {
+	for serviceKey, rawService := range r.Services {
 		var chosenStateKey int
 		var err error
 
@@ -234,6 +417,9 @@ func (b *Boondoggle) configureServices(r RawBoondoggle, setStateAll string, serv
 			if serviceStates[rawService.Name] != "" {
 				// if we have a override in the serviceStates, get the state values based on that name.
 				chosenStateKey, err = getRawStateKeyByName(rawService.Name, serviceStates[rawService.Name], r)
+			} else if profileStates[rawService.Name] != "" {
+				// then the state from the chosen profile.
+				chosenStateKey, err = getRawStateKeyByName(rawService.Name, profileStates[rawService.Name], r)
 			} else {
 				// if not, find the default
 				chosenStateKey, err = getRawStateKeyByName(rawService.Name, "default", r)
@@ -244,18 +430,21 @@ func (b *Boondoggle) configureServices(r RawBoondoggle, setStateAll string, serv
 
 		if err != nil {
 			// indicates there was not a match for the given service and state-name
-			b.L.Print(err)
+			errs = append(errs, ConfigError{Path: fmt.Sprintf("services[%d].states", serviceKey), Message: err.Error()})
 		} else {
 			// build the service from the selected state
 			var completeService = Service{
 				Name:           rawService.Name,
+				State:          rawService.States[chosenStateKey].StateName,
 				Path:           rawService.Path,
 				Gitrepo:        rawService.Gitrepo,
+				GitRef:         rawService.States[chosenStateKey].GitRef,
 				Alias:          rawService.Alias,
 				Chart:          rawService.Chart,
-				ContainerBuild: b.escapableEnvVarReplace(rawService.States[chosenStateKey].ContainerBuild),
+				ContainerBuild: b.escapableEnvVarReplaceSlice(rawService.States[chosenStateKey].ContainerBuild),
 				Repository:     rawService.States[chosenStateKey].Repository,
-				HelmValues:     b.escapableEnvVarReplaceSlice(rawService.States[chosenStateKey].HelmValues),
+				HelmValues:     b.helmValuesEnvVarReplace(rawService.States[chosenStateKey].HelmValues),
+				ValuesFiles:    b.escapableEnvVarReplaceSlice(rawService.States[chosenStateKey].ValuesFiles),
 				Version:        rawService.States[chosenStateKey].Version,
 				Condition:      rawService.States[chosenStateKey].Condition,
 				Tags:           rawService.States[chosenStateKey].Tags,
@@ -280,8 +469,12 @@ func (b *Boondoggle) configureServices(r RawBoondoggle, setStateAll string, serv
 			if len(rawService.States[chosenStateKey].PreDeploySteps) > 0 {
 				for _, val := range rawService.States[chosenStateKey].PreDeploySteps {
 					completeService.PreDeploySteps = append(completeService.PreDeploySteps, Step{
-						Cmd:  val.Cmd,
-						Args: b.escapableEnvVarReplaceSlice(val.Args),
+						Cmd:             val.Cmd,
+						Args:            b.escapableEnvVarReplaceSlice(val.Args),
+						ContinueOnError: val.ContinueOnError,
+						Timeout:         val.Timeout,
+						Workdir:         b.escapableEnvVarReplace(val.Workdir),
+						Env:             b.escapableEnvVarReplaceSlice(val.Env),
 					})
 				}
 			}
@@ -289,8 +482,12 @@ func (b *Boondoggle) configureServices(r RawBoondoggle, setStateAll string, serv
 			if len(rawService.States[chosenStateKey].PostDeploySteps) > 0 {
 				for _, val := range rawService.States[chosenStateKey].PostDeploySteps {
 					completeService.PostDeploySteps = append(completeService.PostDeploySteps, Step{
-						Cmd:  val.Cmd,
-						Args: b.escapableEnvVarReplaceSlice(val.Args),
+						Cmd:             val.Cmd,
+						Args:            b.escapableEnvVarReplaceSlice(val.Args),
+						ContinueOnError: val.ContinueOnError,
+						Timeout:         val.Timeout,
+						Workdir:         b.escapableEnvVarReplace(val.Workdir),
+						Env:             b.escapableEnvVarReplaceSlice(val.Env),
 					})
 				}
 			}
@@ -309,6 +506,7 @@ func (b *Boondoggle) configureServices(r RawBoondoggle, setStateAll string, serv
 			b.Services = append(b.Services, completeService)
 		}
 	}
+	return errs
 }
 
 // returns a mapping of the --service-state flags from the user's command.
@@ -316,8 +514,11 @@ func getServiceStatesMap(serviceState []string) map[string]string {
 	var serviceStatesMap = make(map[string]string)
 	for _, value := range serviceState {
 		// --service-state flag is formatted "name=value", split on the "=" and return a map of the values.
-		splitServiceState := strings.Split(value, "=")
-		serviceStatesMap[splitServiceState[0]] = splitServiceState[1]
+		// Malformed values are reported by checkNameValueFlags.
+		splitServiceState := strings.SplitN(value, "=", 2)
+		if len(splitServiceState) == 2 {
+			serviceStatesMap[splitServiceState[0]] = splitServiceState[1]
+		}
 	}
 	return serviceStatesMap
 }
@@ -348,6 +549,43 @@ func (b *Boondoggle) escapableEnvVarReplaceSlice(s []string) []string {
 	return s
 }
 
+// helmValuesEnvVarReplace replaces the environment variables in the keys and values of helm values.
+func (b *Boondoggle) helmValuesEnvVarReplace(v []HelmValue) []HelmValue {
+	replaced := make([]HelmValue, 0, len(v))
+	for _, value := range v {
+		value.Key = b.escapableEnvVarReplace(value.Key)
+		value.Value = b.escapableEnvVarReplace(value.Value)
+		replaced = append(replaced, value)
+	}
+	return replaced
+}
+
+// configValue replaces the environment variables in the value of a config key, and records which ones it refers to
+// so a prompt for the value can name them.
+func (b *Boondoggle) configValue(key string, s string) string {
+	if refs := envVarRefs(s); len(refs) > 0 {
+		if b.envRefs == nil {
+			b.envRefs = map[string][]string{}
+		}
+		b.envRefs[key] = refs
+	}
+	return b.escapableEnvVarReplace(s)
+}
+
+// prompt asks the Prompter for the value of a config key. Secret values are redacted from the verbose output.
+func (b *Boondoggle) prompt(key string, message string, secret bool) (string, error) {
+	value, err := b.P.Prompt(Prompt{Message: message, Key: key, Env: b.envRefs[key], Secret: secret})
+	if secret {
+		b.redact = append(b.redact, value)
+	}
+	return value, err
+}
+
+// helmRepoKey is the config key of a setting of a helm repo.
+func helmRepoKey(name string, setting string) string {
+	return fmt.Sprintf("helm-repos[%s].%s", name, setting)
+}
+
 //escapableEnvVarReplace wraps os.Getenv to allow for escaping with $$.
 //populates from either the system's environment variables or Boondoggle.ExtraEnv
 func (b *Boondoggle) escapableEnvVarReplace(s string) string {
@@ -364,10 +602,31 @@ func (b *Boondoggle) escapableEnvVarReplace(s string) string {
 			}
 		}
 
+		value := realEnvVal
 		if extraEnvVal != "" {
-			return extraEnvVal
+			value = extraEnvVal
 		}
-
-		return realEnvVal
+		if value != "" {
+			if b.usedEnv == nil {
+				b.usedEnv = map[string]string{}
+			}
+			b.usedEnv[s] = value
+		}
+		return value
 	})
 }
+
+// UsedEnv returns the environment variables that were replaced in boondoggle.yml, with their values.
+// The variables of credentials are left out, so they are never saved.
+func (b *Boondoggle) UsedEnv() map[string]string {
+	used := map[string]string{}
+	for name, value := range b.usedEnv {
+		used[name] = value
+	}
+	for _, refs := range b.envRefs {
+		for _, name := range refs {
+			delete(used, name)
+		}
+	}
+	return used
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 type TestSet struct {
 	TestName          string
 	Environment       string
+	Profile           string
 	SetStateAll       string
 	ServiceState      []string
 	ExtraEnv          map[string]string
@@ -66,11 +68,23 @@ var tests = []TestSet{
 		Release:     "testrelease",
 		UseSecrets:  false,
 		ExpectInResult: []string{
-			"--set service1-chart.boondoggleCacheBust",
-			"--set alias-service2.boondoggleCacheBust",
+			"--set-string service1-chart.boondoggleCacheBust",
+			"--set-string alias-service2.boondoggleCacheBust",
 		},
 		SetStateAll: "local",
 	},
+	{
+		TestName:     "Test Profile",
+		Profile:      "frontend-dev",
+		ServiceState: []string{"service2=local"},
+		Namespace:    "mynamespace",
+		Release:      "testrelease",
+		ExpectInResult: []string{
+			"--set-string service1-chart.boondoggleCacheBust",
+			"--set-string alias-service2.localdev=true",
+			"--set-string global.myglobalvalue=SomeValueTest",
+		},
+	},
 	{
 		TestName:  "Test Extra Env",
 		Namespace: "mynamespace",
@@ -82,10 +96,10 @@ var tests = []TestSet{
 		UseSecrets: false,
 		ExpectInResult: []string{
 			"--set-string global.myglobalvalue=bar",
-			"--set-string global.withCommas=stuff/, stuff2",
+			"--set-string 'global.withCommas=stuff/, stuff2'",
 		},
 		NotExpectInResult: []string{
-			"--set alias-service2.boondoggleCacheBust",
+			"--set-string alias-service2.boondoggleCacheBust",
 		},
 	},
 	{
@@ -125,10 +139,15 @@ func TestUpgradeCommandBuilder(t *testing.T) {
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Println(err)
 	}
-	var config RawBoondoggle
-	viper.Unmarshal(&config)
+	config, err := UnmarshalConfig(viper.GetViper())
+	if err != nil {
+		fmt.Println(err)
+	}
 	for _, value := range tests {
-		b := NewBoondoggle(config, value.Environment, value.SetStateAll, value.ServiceState, value.ExtraEnv, log.New(os.Stdout, "", 0), false, false)
+		b, err := NewBoondoggle(config, value.Environment, value.Profile, value.SetStateAll, value.ServiceState, value.ExtraEnv, log.New(os.Stdout, "", 0), false, false)
+		if err != nil {
+			t.Error("\n For the test:", value.TestName, "\n", "Unexpected error:", err)
+		}
 		out, _ := b.DoUpgrade(value.Namespace, value.Release, true, value.UseSecrets, value.TLS, value.TillerNamespace)
 		for _, expected := range value.ExpectInResult {
 			if strings.Contains(string(out), expected) == false {
@@ -151,3 +170,39 @@ func TestUpgradeCommandBuilder(t *testing.T) {
 		}
 	}
 }
+
+func TestUninstallCommandBuilder(t *testing.T) {
+	b := Boondoggle{HelmVersion: 2, L: log.New(os.Stdout, "", 0)}
+	out, _ := b.DoUninstall("mynamespace", "testrelease", true, true, "tiller-namespace")
+	expected := "[helm delete --purge testrelease --tiller-namespace tiller-namespace --tls]"
+	if string(out) != expected {
+		t.Error("Expected:", expected, "Got:", string(out))
+	}
+
+	b.HelmVersion = 3
+	out, _ = b.DoUninstall("mynamespace", "testrelease", true, true, "tiller-namespace")
+	expected = "[helm uninstall testrelease --namespace mynamespace]"
+	if string(out) != expected {
+		t.Error("Expected:", expected, "Got:", string(out))
+	}
+}
+
+func TestGetBuildTags(t *testing.T) {
+	tags := getBuildTags([]string{"build", "-t", "myaccount/myimage:dev", "--tag=myaccount/myimage:latest", "source-projects/my-dependency/."})
+	if len(tags) != 2 || tags[0] != "myaccount/myimage:dev" || tags[1] != "myaccount/myimage:latest" {
+		t.Error("Expected both tags, got:", tags)
+	}
+}
+
+func TestUsedEnv(t *testing.T) {
+	os.Setenv("BOONDOGGLE_TEST_REGISTRY_PASSWORD", "hunter2")
+	defer os.Unsetenv("BOONDOGGLE_TEST_REGISTRY_PASSWORD")
+	b := Boondoggle{ExtraEnv: map[string]string{"FOO": "bar"}}
+	b.escapableEnvVarReplace("global.myglobalvalue=$FOO,$BOONDOGGLE_TEST_UNSET,$$")
+	b.DockerPassword = b.configValue("docker_password", "$BOONDOGGLE_TEST_REGISTRY_PASSWORD")
+
+	expected := map[string]string{"FOO": "bar"}
+	if !reflect.DeepEqual(b.UsedEnv(), expected) {
+		t.Errorf("Expected %v, got %v", expected, b.UsedEnv())
+	}
+}
@@ -0,0 +1,299 @@
+package boondoggle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// LocalConfigName is the file next to boondoggle.yml that is merged on top of it. It is meant to be gitignored.
+const LocalConfigName = "boondoggle.local.yml"
+
+// includeKeys are the keys an included file can contribute. Every other key is an error.
+var includeKeys = map[string]bool{"services": true, "helm-repos": true, "umbrella": true}
+
+// mergeKeys are the lists whose items are merged by the value of a key instead of being replaced.
+var mergeKeys = map[string]string{
+	"services":     "name",
+	"states":       "state-name",
+	"helm-repos":   "name",
+	"environments": "name",
+}
+
+// ConfigSource is the file, and the path in that file, that a part of the merged config came from.
+type ConfigSource struct {
+	File string
+	Path string
+}
+
+// ConfigSources maps paths in the merged config, eg. services[12], to where they were defined.
+type ConfigSources map[string]ConfigSource
+
+/*
+LoadConfig reads the boondoggle.yml at path and merges the files listed in its include key and the
+boondoggle.local.yml next to it, in that order. Globs are allowed in include and are relative to boondoggle.yml.
+Included files can only contribute services, helm-repos and umbrella.environments.
+Lists of services, helm-repos and environments are merged by name and the states of a service by state-name.
+Everything else set by a later file replaces what was set before.
+*/
+func LoadConfig(path string) (*viper.Viper, ConfigSources, error) {
+	sources := ConfigSources{}
+	config, err := readConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged := map[string]interface{}{}
+	mergeMap(merged, config, "", path, sources)
+
+	includes, err := configIncludes(path, merged["include"])
+	if err != nil {
+		return nil, nil, err
+	}
+	delete(merged, "include")
+
+	var errs ConfigErrors
+	for _, include := range includes {
+		config, err := readConfigFile(include)
+		if err != nil {
+			return nil, nil, err
+		}
+		for key := range config {
+			if !includeKeys[key] {
+				errs = append(errs, ConfigError{File: include, Path: key, Message: fmt.Sprintf("%s can not be set in an included file", key)})
+				delete(config, key)
+			}
+		}
+		if umbrella, ok := config["umbrella"].(map[string]interface{}); ok {
+			for key := range umbrella {
+				if key != "environments" {
+					errs = append(errs, ConfigError{File: include, Path: "umbrella." + key, Message: fmt.Sprintf("umbrella.%s can not be set in an included file", key)})
+					delete(umbrella, key)
+				}
+			}
+		}
+		mergeMap(merged, config, "", include, sources)
+	}
+
+	localPath := filepath.Join(filepath.Dir(path), LocalConfigName)
+	if _, err := os.Stat(localPath); err == nil {
+		config, err := readConfigFile(localPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := config["include"]; ok {
+			errs = append(errs, ConfigError{File: localPath, Path: "include", Message: "include can not be set in " + LocalConfigName})
+			delete(config, "include")
+		}
+		mergeMap(merged, config, "", localPath, sources)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	err = v.MergeConfigMap(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(errs) > 0 {
+		return v, sources, errs.AddSources(path, sources)
+	}
+	return v, sources, nil
+}
+
+// readConfigFile reads a yaml file with its keys lower-cased, the same way viper reads boondoggle.yml.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	configBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the config file %s: %s", path, err)
+	}
+	config := map[string]interface{}{}
+	err = yamlv3.Unmarshal(configBytes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the config file %s: %s", path, err)
+	}
+	return lowerKeys(config).(map[string]interface{}), nil
+}
+
+func lowerKeys(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		lowered := make(map[string]interface{}, len(typed))
+		for key, v := range typed {
+			lowered[strings.ToLower(key)] = lowerKeys(v)
+		}
+		return lowered
+	case []interface{}:
+		for i, v := range typed {
+			typed[i] = lowerKeys(v)
+		}
+	}
+	return value
+}
+
+// configIncludes expands the include globs of the config file at path, in order and without duplicates.
+func configIncludes(path string, include interface{}) ([]string, error) {
+	if include == nil {
+		return nil, nil
+	}
+	patterns, ok := include.([]interface{})
+	if !ok {
+		patterns = []interface{}{include}
+	}
+	var includes []string
+	seen := map[string]bool{path: true}
+	for _, pattern := range patterns {
+		patternString, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("error in the include of %s: %v is not a file name", path, pattern)
+		}
+		if !filepath.IsAbs(patternString) {
+			patternString = filepath.Join(filepath.Dir(path), patternString)
+		}
+		matches, err := filepath.Glob(patternString)
+		if err != nil {
+			return nil, fmt.Errorf("error in the include of %s: %s", path, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(patternString, "*?[") {
+			return nil, fmt.Errorf("error in the include of %s: %s does not exist", path, patternString)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				includes = append(includes, match)
+			}
+		}
+	}
+	return includes, nil
+}
+
+// mergeMap merges src into dst. file is recorded in sources as the origin of the list items and top level keys of src.
+func mergeMap(dst map[string]interface{}, src map[string]interface{}, path string, file string, sources ConfigSources) {
+	for key, value := range src {
+		keyPath := joinPath(path, key)
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		srcList, srcIsList := value.([]interface{})
+		dstList, _ := dst[key].([]interface{})
+		// A top level map, like umbrella, keeps the file that first set it.
+		if _, ok := sources[keyPath]; path == "" && (!ok || !srcIsMap) {
+			sources[keyPath] = ConfigSource{File: file, Path: keyPath}
+		}
+		switch {
+		case srcIsMap:
+			if !dstIsMap {
+				// Maps are always merged into a new map, to record the sources of the lists in them.
+				dstMap = map[string]interface{}{}
+				dst[key] = dstMap
+			}
+			mergeMap(dstMap, srcMap, keyPath, file, sources)
+		case srcIsList && mergeKeys[key] != "":
+			dst[key] = mergeList(dstList, srcList, mergeKeys[key], keyPath, file, sources)
+		default:
+			dst[key] = value
+		}
+	}
+}
+
+// mergeList merges the items of src into dst by the value of their itemKey. Items without that key are added.
+func mergeList(dst []interface{}, src []interface{}, itemKey string, path string, file string, sources ConfigSources) []interface{} {
+	for srcIndex, item := range src {
+		srcPath := fmt.Sprintf("%s[%d]", path, srcIndex)
+		itemMap, ok := item.(map[string]interface{})
+		dstIndex := -1
+		if ok && itemMap[itemKey] != nil {
+			for i, existing := range dst {
+				if existingMap, ok := existing.(map[string]interface{}); ok && fmt.Sprint(existingMap[itemKey]) == fmt.Sprint(itemMap[itemKey]) {
+					dstIndex = i
+					break
+				}
+			}
+		}
+		if dstIndex < 0 {
+			dstIndex = len(dst)
+			if ok {
+				// Like maps, new items are merged into a new map to record the sources of their lists.
+				dst = append(dst, map[string]interface{}{})
+			} else {
+				dst = append(dst, item)
+			}
+		}
+		dstPath := fmt.Sprintf("%s[%d]", path, dstIndex)
+		sources[dstPath] = ConfigSource{File: file, Path: sourcePath(sources, srcPath, file)}
+		if ok {
+			mergeMap(dst[dstIndex].(map[string]interface{}), itemMap, dstPath, file, sources)
+		}
+	}
+	return dst
+}
+
+// sourcePath converts the path of an item of a nested list from the merged config to the file the item came from.
+// The states of services[12] could be in services[0] of an included file.
+func sourcePath(sources ConfigSources, path string, file string) string {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return path
+	}
+	if parent, ok := sources[path[:i]]; ok && parent.File == file {
+		return parent.Path + path[i:]
+	}
+	return path
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// AddSources sets the file and the line number of each error, using the sources returned by LoadConfig.
+// Errors that are not from an included file are looked up in mainFile.
+func (e ConfigErrors) AddSources(mainFile string, sources ConfigSources) ConfigErrors {
+	files := map[string]*yamlv3.Node{}
+	for key, configError := range e {
+		if configError.Path == "" {
+			continue
+		}
+		file, path := configError.File, configError.Path
+		if file == "" {
+			file, path = mainFile, configError.Path
+			if source, prefix, ok := sources.lookup(configError.Path); ok {
+				file, path = source.File, source.Path+configError.Path[len(prefix):]
+			}
+		}
+		if _, ok := files[file]; !ok {
+			files[file] = nil
+			configBytes, err := ioutil.ReadFile(file)
+			var root yamlv3.Node
+			if err == nil && yamlv3.Unmarshal(configBytes, &root) == nil && len(root.Content) > 0 {
+				files[file] = root.Content[0]
+			}
+		}
+		e[key].File = file
+		if files[file] != nil {
+			e[key].Line = findLine(files[file], path)
+		}
+	}
+	return e
+}
+
+// lookup finds the source of the longest prefix of path.
+func (s ConfigSources) lookup(path string) (ConfigSource, string, bool) {
+	for prefix := path; prefix != ""; {
+		if source, ok := s[prefix]; ok {
+			return source, prefix, true
+		}
+		i := strings.LastIndexAny(prefix, ".[")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return ConfigSource{}, "", false
+}
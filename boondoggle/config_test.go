@@ -0,0 +1,168 @@
+package boondoggle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const mainConfig = `helmVersion: 3
+include:
+  - teams/*.yml
+helm-repos:
+  - name: stable
+    url: https://example.com/stable
+umbrella:
+  name: my-umbrella
+  path: /my-umbrella
+  environments:
+    - name: default
+      files:
+        - values.yml
+services:
+  - name: service1
+    chart: service1-chart
+    states:
+      - state-name: default
+        repository: "@stable"
+        version: 1.0.0
+`
+
+const teamConfig = `helm-repos:
+  - name: team
+    url: https://example.com/team
+umbrella:
+  environments:
+    - name: team
+      files:
+        - team.yml
+services:
+  - name: service1
+    states:
+      - state-name: local
+        repository: localdev
+  - name: service2
+    chart: service2-chart
+    states:
+      - state-name: default
+        repository: "@team"
+        version: 2.0.0
+`
+
+const localConfig = `helmBackend: sdk
+services:
+  - name: service2
+    states:
+      - state-name: default
+        version: 2.1.0
+`
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "boondoggle-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"boondoggle.yml":       mainConfig,
+		"teams/a.yml":          teamConfig,
+		"boondoggle.local.yml": localConfig,
+	})
+	defer os.RemoveAll(dir)
+
+	v, _, err := LoadConfig(filepath.Join(dir, "boondoggle.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := UnmarshalConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.UnknownKeys) > 0 {
+		t.Error("Expected no unknown keys, got:", config.UnknownKeys)
+	}
+	if config.HelmBackend != "sdk" {
+		t.Error("Expected boondoggle.local.yml to set helmBackend, got:", config.HelmBackend)
+	}
+	if len(config.HelmRepos) != 2 || len(config.Umbrella.Environments) != 2 || config.Umbrella.Name != "my-umbrella" {
+		t.Error("Expected the helm-repos and environments to be merged, got:", config.HelmRepos, config.Umbrella)
+	}
+	if len(config.Services) != 2 {
+		t.Fatal("Expected the services to be merged by name, got:", config.Services)
+	}
+
+	var states []string
+	for _, state := range config.Services[0].States {
+		states = append(states, state.StateName)
+	}
+	if !reflect.DeepEqual(states, []string{"default", "local"}) || config.Services[0].Chart != "service1-chart" {
+		t.Error("Expected the states of service1 to be merged by state-name, got:", config.Services[0])
+	}
+	service2 := config.Services[1]
+	if len(service2.States) != 1 || service2.States[0].Version != "2.1.0" || service2.States[0].Repository != "@team" {
+		t.Error("Expected boondoggle.local.yml to override the version of service2, got:", service2)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"boondoggle.yml": mainConfig,
+		"teams/a.yml":    "helmVersion: 2\n" + teamConfig,
+	})
+	defer os.RemoveAll(dir)
+
+	_, _, err := LoadConfig(filepath.Join(dir, "boondoggle.yml"))
+	configErrors, ok := err.(ConfigErrors)
+	if !ok || len(configErrors) != 1 {
+		t.Fatal("Expected one ConfigError, got:", err)
+	}
+	expected := filepath.Join(dir, "teams/a.yml") + ": line 1: helmversion can not be set in an included file"
+	if configErrors[0].Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, configErrors[0].Error())
+	}
+}
+
+func TestAddSources(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"boondoggle.yml": mainConfig,
+		"teams/a.yml":    teamConfig,
+	})
+	defer os.RemoveAll(dir)
+
+	mainFile := filepath.Join(dir, "boondoggle.yml")
+	_, sources, err := LoadConfig(mainFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configErrors := ConfigErrors{
+		{Path: "services[1].states", Message: "service2"},
+		{Path: "services[0].states[1]", Message: "local state"},
+		{Path: "umbrella.environments[0]", Message: "default environment"},
+	}.AddSources(mainFile, sources)
+
+	team := filepath.Join(dir, "teams/a.yml")
+	expected := []string{
+		team + ": line 16: service2",
+		team + ": line 12: local state",
+		mainFile + ": line 11: default environment",
+	}
+	for key, configError := range configErrors {
+		if configError.Error() != expected[key] {
+			t.Errorf("Expected %q, got %q", expected[key], configError.Error())
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package boondoggle
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	yamlv3 "gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+/*
+Diff renders the umbrella chart with the values of Boondoggle, without the localdev cache buster, and compares it with
+the manifest of the deployed release. It returns a colored unified diff of each kubernetes resource that changed,
+followed by the changes to the dependencies in r, and whether there was any change.
+The umbrella chart must already have its dependencies, like for DoUpgrade. Requires helm 3.
+*/
+func (b *Boondoggle) Diff(namespace string, releaseName string, useSecrets bool, r Requirements) (string, bool, error) {
+	if b.is2() {
+		return "", false, fmt.Errorf("boondoggle diff requires helmVersion 3")
+	}
+	rendered, err := b.renderUmbrella(namespace, releaseName, useSecrets)
+	if err != nil {
+		return "", false, err
+	}
+	var deployedManifest string
+	var deployedChart *chart.Chart
+	rel, err := b.getRelease(namespace, releaseName)
+	if _, ok := err.(releaseNotDeployedError); ok {
+		b.L.Print(Format(Yellow, err.Error()+", everything will be added."))
+	} else if err != nil {
+		return "", false, err
+	} else {
+		deployedManifest, deployedChart = rel.Manifest, rel.Chart
+	}
+
+	var out bytes.Buffer
+	resourcesChanged := diffManifests(&out, deployedManifest, rendered)
+	depsChanged := diffDependencies(&out, deployedChart, r)
+	if !resourcesChanged && !depsChanged {
+		out.WriteString(Format(Green, "No changes.") + "\n")
+	}
+	return out.String(), resourcesChanged || depsChanged, nil
+}
+
+// renderUmbrella runs "helm template" for the umbrella chart, without the hooks.
+func (b *Boondoggle) renderUmbrella(namespace string, releaseName string, useSecrets bool) (string, error) {
+	valueArgs, valueOpts, cleanup, err := b.helmValueArgs(false)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	if b.useHelmSDK() {
+		if useSecrets {
+			return "", fmt.Errorf("the helm secrets plugin can not be used with the sdk helm backend")
+		}
+		settings := b.helmSettings(namespace)
+		vals, err := valueOpts.MergeValues(getter.All(settings))
+		if err != nil {
+			return "", fmt.Errorf("error reading the helm values: %s", err)
+		}
+		umbrella, err := loader.Load(b.Umbrella.Path)
+		if err != nil {
+			return "", fmt.Errorf("error loading the umbrella chart: %s", err)
+		}
+		// Like "helm template", the chart is rendered without a cluster.
+		install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+		install.DryRun = true
+		install.ClientOnly = true
+		install.Replace = true
+		install.ReleaseName = releaseName
+		install.Namespace = settings.Namespace()
+		rel, err := install.Run(umbrella, vals)
+		if err != nil {
+			return "", fmt.Errorf("error rendering the umbrella chart: %s", err)
+		}
+		return rel.Manifest, nil
+	}
+
+	fullcommand := []string{"template", releaseName, b.Umbrella.Path, "--no-hooks"}
+	fullcommand = append(fullcommand, valueArgs...)
+	if namespace != "" {
+		fullcommand = append(fullcommand, "--namespace", namespace)
+	}
+	if useSecrets {
+		fullcommand = append([]string{"secrets"}, fullcommand...)
+	}
+	cmd := NewCommand("helm", fullcommand...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.Output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error rendering the umbrella chart: %s", err)
+	}
+	return string(out), nil
+}
+
+// splitManifest splits a manifest into its resources, keyed by kind, namespace and name.
+func splitManifest(manifest string) map[string]string {
+	resources := map[string]string{}
+	for _, doc := range strings.Split("\n"+manifest, "\n---") {
+		doc = strings.TrimSpace(doc)
+		var resource struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if yamlv3.Unmarshal([]byte(doc), &resource) != nil || resource.Kind == "" {
+			continue
+		}
+		key := resource.Kind + " " + resource.Metadata.Name
+		if resource.Metadata.Namespace != "" {
+			key = resource.Kind + " " + resource.Metadata.Namespace + "/" + resource.Metadata.Name
+		}
+		resources[key] = doc + "\n"
+	}
+	return resources
+}
+
+// diffManifests writes a unified diff of each resource that is different between the two manifests.
+func diffManifests(out *bytes.Buffer, deployed string, rendered string) bool {
+	deployedResources := splitManifest(deployed)
+	renderedResources := splitManifest(rendered)
+	var keys []string
+	for key := range deployedResources {
+		keys = append(keys, key)
+	}
+	for key := range renderedResources {
+		if _, ok := deployedResources[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changed := false
+	for _, key := range keys {
+		if deployedResources[key] == renderedResources[key] {
+			continue
+		}
+		changed = true
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(deployedResources[key]),
+			B:        difflib.SplitLines(renderedResources[key]),
+			FromFile: "deployed",
+			ToFile:   "boondoggle",
+			Context:  3,
+		})
+		switch {
+		case deployedResources[key] == "":
+			out.WriteString(Format(Cyan, key+" will be added") + "\n")
+		case renderedResources[key] == "":
+			out.WriteString(Format(Cyan, key+" will be removed") + "\n")
+		default:
+			out.WriteString(Format(Cyan, key+" will be changed") + "\n")
+		}
+		for _, line := range strings.SplitAfter(diff, "\n") {
+			switch {
+			case strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---"):
+				out.WriteString(line)
+			case strings.HasPrefix(line, "+"):
+				out.WriteString(Format(Green, strings.TrimSuffix(line, "\n")) + "\n")
+			case strings.HasPrefix(line, "-"):
+				out.WriteString(Format(Red, strings.TrimSuffix(line, "\n")) + "\n")
+			default:
+				out.WriteString(line)
+			}
+		}
+	}
+	return changed
+}
+
+// diffDependencies writes the dependencies of r that were added, removed, or have a new version or repository.
+func diffDependencies(out *bytes.Buffer, deployedChart *chart.Chart, r Requirements) bool {
+	deployed := map[string]*chart.Dependency{}
+	if deployedChart != nil && deployedChart.Metadata != nil {
+		for _, dep := range deployedChart.Metadata.Dependencies {
+			name := dep.Alias
+			if name == "" {
+				name = dep.Name
+			}
+			deployed[name] = dep
+		}
+	}
+
+	var lines []string
+	for _, dep := range r.Dependencies {
+		name := dep.Alias
+		if name == "" {
+			name = dep.Name
+		}
+		current, ok := deployed[name]
+		delete(deployed, name)
+		switch {
+		case !ok:
+			lines = append(lines, Format(Green, fmt.Sprintf("  %s: added, version %s from %s", name, dep.Version, dep.Repository)))
+		case current.Repository != dep.Repository:
+			lines = append(lines, Format(Yellow, fmt.Sprintf("  %s: repository %s -> %s, version %s -> %s", name, current.Repository, dep.Repository, current.Version, dep.Version)))
+		case current.Version != dep.Version:
+			lines = append(lines, Format(Yellow, fmt.Sprintf("  %s: version %s -> %s", name, current.Version, dep.Version)))
+		}
+	}
+	var removed []string
+	for name := range deployed {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		lines = append(lines, Format(Red, fmt.Sprintf("  %s: removed", name)))
+	}
+
+	if len(lines) == 0 {
+		return false
+	}
+	out.WriteString(Format(Cyan, "Dependency changes:") + "\n")
+	out.WriteString(strings.Join(lines, "\n") + "\n")
+	return true
+}
@@ -0,0 +1,114 @@
+package boondoggle
+
+import (
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const deployedManifest = `---
+# Source: my-umbrella/charts/service1-chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: service1
+spec:
+  replicas: 1
+---
+# Source: my-umbrella/charts/service1-chart/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: service1-config
+data:
+  key: value
+`
+
+const renderedManifest = `---
+# Source: my-umbrella/charts/service1-chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: service1
+spec:
+  replicas: 2
+---
+# Source: my-umbrella/charts/service2-chart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: service2
+`
+
+func TestDiff(t *testing.T) {
+	rel := release.Release{
+		Name:     "testrelease",
+		Manifest: deployedManifest,
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				Dependencies: []*chart.Dependency{
+					{Name: "service1-chart", Version: "~1", Repository: "@my-private-repo"},
+					{Name: "old-chart", Version: "~1", Repository: "@my-private-repo"},
+				},
+			},
+		},
+	}
+	b, runner := newFakeBoondoggle(
+		FakeResponse{Prefix: "helm template", Out: renderedManifest},
+		FakeResponse{Prefix: "kubectl get secrets", Out: releaseSecret(t, rel)},
+	)
+	b.HelmVersion = 3
+	b.Umbrella.Path = "/my-umbrella"
+	b.Services = []Service{
+		{Name: "service1", Chart: "service1-chart", Repository: "@my-private-repo"},
+		{Name: "service2", Chart: "service2-chart", Alias: "alias-service2", Repository: "localdev"},
+	}
+	r := Requirements{Dependencies: []Dependency{
+		{Name: "service1-chart", Version: "~2", Repository: "@my-private-repo"},
+		{Name: "service2-chart", Alias: "alias-service2", Version: "x", Repository: "file://../service2"},
+	}}
+
+	out, changed, err := b.Diff("mynamespace", "testrelease", false, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("Expected Diff to report changes")
+	}
+	if strings.Contains(runner.CommandLines()[0], "boondoggleCacheBust") {
+		t.Error("Expected the cache buster to be left out of helm template, got:", runner.CommandLines()[0])
+	}
+	expected := []string{
+		Format(Cyan, "ConfigMap service1-config will be removed"),
+		Format(Cyan, "Deployment service1 will be changed"),
+		Format(Red, "-  replicas: 1"),
+		Format(Green, "+  replicas: 2"),
+		Format(Cyan, "Service service2 will be added"),
+		Format(Yellow, "  service1-chart: version ~1 -> ~2"),
+		Format(Green, "  alias-service2: added, version x from file://../service2"),
+		Format(Red, "  old-chart: removed"),
+	}
+	for _, expectedLine := range expected {
+		if !strings.Contains(out, expectedLine) {
+			t.Errorf("Expected to find %q in:\n%s", expectedLine, out)
+		}
+	}
+}
+
+func TestDiffNoChanges(t *testing.T) {
+	rel := release.Release{Name: "testrelease", Manifest: deployedManifest}
+	b, _ := newFakeBoondoggle(
+		FakeResponse{Prefix: "helm template", Out: deployedManifest},
+		FakeResponse{Prefix: "kubectl get secrets", Out: releaseSecret(t, rel)},
+	)
+	b.HelmVersion = 3
+	out, changed, err := b.Diff("mynamespace", "testrelease", false, Requirements{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || !strings.Contains(out, "No changes.") {
+		t.Error("Expected no changes, got:", out)
+	}
+}
@@ -0,0 +1,76 @@
+package boondoggle
+
+import "fmt"
+
+// UmbrellaEnvironment is an environment of the umbrella in boondoggle.yml.
+type UmbrellaEnvironment struct {
+	Name string `mapstructure:"name" yaml:"name"`
+	// Extends is the name of the environment whose files, values and addtlHelmFlags come before the ones of this environment.
+	Extends        string   `mapstructure:"extends,omitempty" yaml:"extends,omitempty"`
+	Files          []string `mapstructure:"files,omitempty" yaml:"files,omitempty"`
+	Values         []string `mapstructure:"values,omitempty" yaml:"values,omitempty"`
+	AddtlHelmFlags []string `mapstructure:"addtlHelmFlags,omitempty" yaml:"addtlHelmFlags,omitempty"`
+}
+
+// extendsError is a broken extends chain. Env is the environment whose extends is wrong, so it is reported once.
+type extendsError struct {
+	Env     string
+	Message string
+}
+
+func (e extendsError) Error() string {
+	return e.Message
+}
+
+// rawUmbrellaEnvKey returns the key of the named environment, or -1.
+func rawUmbrellaEnvKey(name string, r RawBoondoggle) int {
+	for key, env := range r.Umbrella.Environments {
+		if env.Name == name {
+			return key
+		}
+	}
+	return -1
+}
+
+// ResolveUmbrellaEnvironment returns the named environment with the files, values and addtlHelmFlags of the
+// environments it extends, those of the furthest one first.
+func ResolveUmbrellaEnvironment(name string, r RawBoondoggle) (UmbrellaEnvironment, error) {
+	keys, err := getRawUmbrellaEnvkeyByName(name, r)
+	if err != nil {
+		return UmbrellaEnvironment{}, err
+	}
+	resolved := UmbrellaEnvironment{Name: name}
+	for _, key := range keys {
+		env := r.Umbrella.Environments[key]
+		resolved.Files = append(resolved.Files, env.Files...)
+		resolved.Values = append(resolved.Values, env.Values...)
+		resolved.AddtlHelmFlags = append(resolved.AddtlHelmFlags, env.AddtlHelmFlags...)
+	}
+	return resolved, nil
+}
+
+// checkEnvironments finds the environments that extend an unknown environment, or themselves.
+func checkEnvironments(r RawBoondoggle) ConfigErrors {
+	var errs ConfigErrors
+	for key, env := range r.Umbrella.Environments {
+		if env.Extends == "" {
+			continue
+		}
+		_, err := getRawUmbrellaEnvkeyByName(env.Name, r)
+		if extendsErr, ok := err.(extendsError); ok && extendsErr.Env == env.Name {
+			errs = append(errs, ConfigError{Path: fmt.Sprintf("umbrella.environments[%d].extends", key), Message: extendsErr.Message})
+		}
+	}
+	return errs
+}
+
+// cycleOwner is the environment of a cycle that it is reported for: the first one in boondoggle.yml.
+func cycleOwner(cycle []string, r RawBoondoggle) string {
+	owner := cycle[0]
+	for _, name := range cycle {
+		if rawUmbrellaEnvKey(name, r) < rawUmbrellaEnvKey(owner, r) {
+			owner = name
+		}
+	}
+	return owner
+}
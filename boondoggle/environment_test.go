@@ -0,0 +1,102 @@
+package boondoggle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func environmentsConfig(t *testing.T, environments string) RawBoondoggle {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader("umbrella:\n  environments:\n" + environments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := UnmarshalConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestResolveUmbrellaEnvironment(t *testing.T) {
+	config := environmentsConfig(t, `    - name: dev
+      files: ["local.yml"]
+      values: ["global.localenv=true"]
+      addtlHelmFlags: ["--atomic"]
+    - name: dev-arm
+      extends: dev
+      values: ["global.arch=arm64"]
+    - name: dev-arm-minimal
+      extends: dev-arm
+      files: ["minimal.yml"]
+`)
+	tests := []struct {
+		name     string
+		env      string
+		expected UmbrellaEnvironment
+		err      string
+	}{
+		{"Test No Extends", "dev", UmbrellaEnvironment{Name: "dev", Files: []string{"local.yml"}, Values: []string{"global.localenv=true"}, AddtlHelmFlags: []string{"--atomic"}}, ""},
+		{"Test Extends", "dev-arm", UmbrellaEnvironment{Name: "dev-arm", Files: []string{"local.yml"}, Values: []string{"global.localenv=true", "global.arch=arm64"}, AddtlHelmFlags: []string{"--atomic"}}, ""},
+		{"Test Chain", "dev-arm-minimal", UmbrellaEnvironment{Name: "dev-arm-minimal", Files: []string{"local.yml", "minimal.yml"}, Values: []string{"global.localenv=true", "global.arch=arm64"}, AddtlHelmFlags: []string{"--atomic"}}, ""},
+		{"Test Unknown", "prod", UmbrellaEnvironment{}, "the environment prod was not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := ResolveUmbrellaEnvironment(tt.env, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected the error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(env, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, env)
+			}
+		})
+	}
+
+	b := Boondoggle{}
+	if errs := b.configureUmbrella(config, "dev-arm"); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if !reflect.DeepEqual(b.Umbrella.Values, []string{"global.localenv=true", "global.arch=arm64"}) {
+		t.Error("Expected configureUmbrella to use the values of the extended environment, got:", b.Umbrella.Values)
+	}
+}
+
+func TestCheckEnvironments(t *testing.T) {
+	config := environmentsConfig(t, `    - name: default
+      extends: base
+    - name: base
+      extends: dev
+    - name: dev
+      extends: base
+    - name: test
+      extends: staging
+`)
+	errs := checkEnvironments(config)
+	expected := ConfigErrors{
+		{Path: "umbrella.environments[1].extends", Message: "environment base extends itself: base -> dev -> base"},
+		{Path: "umbrella.environments[3].extends", Message: "environment test extends unknown environment staging"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected %v, got %v", expected, errs)
+	}
+
+	_, err := ResolveUmbrellaEnvironment("default", config)
+	if err == nil || err.Error() != "environment base extends itself: base -> dev -> base" {
+		t.Error("Expected the cycle error, got:", err)
+	}
+	b := Boondoggle{}
+	if errs := b.configureUmbrella(config, ""); len(errs) > 0 {
+		t.Error("Expected the broken extends to only be reported by checkConfig, got:", errs)
+	}
+}
@@ -0,0 +1,128 @@
+package boondoggle
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//This file contains the git commands run by boondoggle to check out service source projects.
+
+var commitRegex = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// CloneServices clones the gitrepo of each service into its path.
+// If localdevOnly is true, only services in a "localdev" state are cloned.
+// A depth greater than 0 makes a shallow clone with that many commits.
+// Existing checkouts are never touched, their clean/dirty status is reported instead.
+func (b *Boondoggle) CloneServices(localdevOnly bool, depth int) error {
+	for _, service := range b.Services {
+		if localdevOnly && service.Repository != "localdev" {
+			continue
+		}
+		if service.Gitrepo == "" || service.Path == "" {
+			if b.Verbose {
+				b.L.Print(fmt.Sprintf("%s has no gitrepo or path, skipping clone.", service.Name))
+			}
+			continue
+		}
+		if _, err := os.Stat(service.Path); err == nil {
+			b.L.Print(fmt.Sprintf("%s already exists at %s (%s). skipping.", service.Name, service.Path, b.checkoutStatus(service.Path)))
+			continue
+		}
+		err := b.cloneService(service, depth)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneService runs git clone for a single service and checks out the service's gitref if there is one.
+func (b *Boondoggle) cloneService(service Service, depth int) error {
+	b.L.Print(fmt.Sprintf("Cloning %s into %s...", service.Name, service.Path))
+
+	// A commit can not be passed to --branch, so it is checked out after a full clone.
+	isCommit := b.isCommit(service.Gitrepo, service.GitRef)
+
+	fullcommand := []string{"clone"}
+	if depth > 0 {
+		if isCommit {
+			b.L.Print(fmt.Sprintf("%s is pinned to commit %s, shallow clone is not possible. doing a full clone.", service.Name, service.GitRef))
+		} else {
+			fullcommand = append(fullcommand, "--depth", strconv.Itoa(depth))
+		}
+	}
+	if service.GitRef != "" && !isCommit {
+		fullcommand = append(fullcommand, "--branch", service.GitRef)
+	}
+	fullcommand = append(fullcommand, service.Gitrepo, service.Path)
+
+	err := b.runGit(fullcommand...)
+	if err != nil {
+		return fmt.Errorf("error cloning %s: %s", service.Name, err)
+	}
+
+	if isCommit {
+		err = b.runGit("-C", service.Path, "checkout", service.GitRef)
+		if err != nil {
+			return fmt.Errorf("error checking out %s for %s: %s", service.GitRef, service.Name, err)
+		}
+	}
+	return nil
+}
+
+// isCommit tells if ref is a commit of repo rather than a branch or a tag. A branch or tag that looks like a commit,
+// eg. "deadbeef", is found with git ls-remote. If the remote can not be listed, the look of ref decides.
+func (b *Boondoggle) isCommit(repo string, ref string) bool {
+	if !commitRegex.MatchString(ref) {
+		return false
+	}
+	cmd := NewCommand("git", "ls-remote", "--heads", "--tags", repo, ref)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.Output(cmd)
+	if err != nil {
+		return true
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasSuffix(line, "refs/heads/"+ref) || strings.HasSuffix(line, "refs/tags/"+ref) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkoutStatus describes the working tree at path as clean or dirty.
+func (b *Boondoggle) checkoutStatus(path string) string {
+	cmd := NewCommand("git", "-C", path, "status", "--porcelain")
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.Output(cmd)
+	if err != nil {
+		return "not a git checkout"
+	}
+	changes := strings.TrimSpace(string(out))
+	if changes == "" {
+		return "clean"
+	}
+	return fmt.Sprintf("dirty, %d changed files", len(strings.Split(changes, "\n")))
+}
+
+func (b *Boondoggle) runGit(args ...string) error {
+	cmd := NewCommand("git", args...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.CombinedOutput(cmd)
+	if b.Verbose {
+		b.L.Print(string(out))
+	}
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package boondoggle
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBareRepoFixture creates a bare git repo with a master branch and a feature branch, each with one commit,
+// and a cafe123 branch that looks like a commit.
+func newBareRepoFixture(t *testing.T, dir string) string {
+	bare := filepath.Join(dir, "origin.git")
+	work := filepath.Join(dir, "work")
+	steps := [][]string{
+		{"init", "--bare", bare},
+		{"init", work},
+		{"-C", work, "checkout", "-b", "master"},
+		{"-C", work, "commit", "--allow-empty", "-m", "first"},
+		{"-C", work, "checkout", "-b", "feature"},
+		{"-C", work, "commit", "--allow-empty", "-m", "second"},
+		{"-C", work, "branch", "cafe123"},
+		{"-C", work, "push", bare, "master", "feature", "cafe123"},
+	}
+	for _, step := range steps {
+		cmd := exec.Command("git", step...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("fixture step %v failed: %s", step, out)
+		}
+	}
+	// --depth is ignored for plain local paths, so use a file:// url.
+	return "file://" + bare
+}
+
+func TestCloneServices(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "boondoggle-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bare := newBareRepoFixture(t, dir)
+
+	var logged strings.Builder
+	b := Boondoggle{
+		L: log.New(&logged, "", 0),
+		R: ExecRunner{},
+		Services: []Service{
+			{Name: "local-service", Gitrepo: bare, GitRef: "feature", Path: filepath.Join(dir, "local-service"), Repository: "localdev"},
+			{Name: "remote-service", Gitrepo: bare, Path: filepath.Join(dir, "remote-service"), Repository: "@my-private-repo"},
+			{Name: "hex-branch-service", Gitrepo: bare, GitRef: "cafe123", Path: filepath.Join(dir, "hex-branch-service"), Repository: "localdev"},
+		},
+	}
+
+	// Only the localdev service is cloned, shallow and on its gitref.
+	if err := b.CloneServices(true, 1); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("git", "-C", filepath.Join(dir, "local-service"), "log", "--format=%s").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(out)) != "second" {
+		t.Error("Expected a shallow clone of the feature branch, got log:", string(out))
+	}
+	out, err = exec.Command("git", "-C", filepath.Join(dir, "hex-branch-service"), "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(out)) != "cafe123" {
+		t.Error("Expected the cafe123 branch to be cloned with --branch, not checked out as a commit, got HEAD:", string(out))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "remote-service")); !os.IsNotExist(err) {
+		t.Error("Expected remote-service not to be cloned when localdevOnly is set")
+	}
+
+	// Existing checkouts are skipped and their status is reported.
+	err = ioutil.WriteFile(filepath.Join(dir, "local-service", "untracked"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CloneServices(false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged.String(), "local-service already exists") || !strings.Contains(logged.String(), "dirty, 1 changed files") {
+		t.Error("Expected the existing checkout to be reported as dirty, got:", logged.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "remote-service", ".git")); err != nil {
+		t.Error("Expected remote-service to be cloned when localdevOnly is not set")
+	}
+}
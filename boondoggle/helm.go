@@ -2,18 +2,21 @@ package boondoggle
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
-	sshterminal "golang.org/x/crypto/ssh/terminal"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
 //This file contains the helm commands run by boondoggle using values from Boondoggle
 
 // DoUpgrade builds and runs the helm upgrade --install command.
+// With the sdk helm backend, the same values are installed in-process and the command is only used for dry runs.
 func (b *Boondoggle) DoUpgrade(namespace string, release string, dryRun bool, useSecrets bool, tls bool, tillerNamespace string) ([]byte, error) {
 	fullcommand := []string{"upgrade", "-i"}
 
@@ -25,52 +28,24 @@ func (b *Boondoggle) DoUpgrade(namespace string, release string, dryRun bool, us
 	// Add the umbrella path
 	fullcommand = append(fullcommand, b.Umbrella.Path)
 
-	// Add files from the umbrella declartion
-	for _, file := range b.Umbrella.Files {
-		chunk := fmt.Sprintf("-f %s/%s", b.Umbrella.Path, file)
-		fullcommand = append(fullcommand, strings.Split(chunk, " ")...)
-	}
-
-	//Set global.projectLocation to the location of the boondoggle.yaml file.
-	//This can be used to map volumes for local dev.
-	projectLocation := fmt.Sprintf("--set global.projectLocation=%s", os.Getenv("PWD"))
-	fullcommand = append(fullcommand, strings.Split(projectLocation, " ")...)
-
-	// Add values from the umbrella declaration
-	for _, value := range b.Umbrella.Values {
-		fullcommand = append(fullcommand, "--set-string", value)
-	}
-
-	// Add values from each service, append the service's chart name(or alias if supplied)
-	for _, service := range b.Services {
-		for _, servicevalue := range service.HelmValues {
-			chunk := fmt.Sprintf("%s.%s", service.GetHelmDepName(), servicevalue)
-			fullcommand = append(fullcommand, "--set-string", chunk)
-		}
-	}
-
-	// For services running in local dev, add the cachebuster
-	for _, service := range b.Services {
-		if service.Repository == "localdev" {
-			now := time.Now()
-			chunk := fmt.Sprintf("--set %s.boondoggleCacheBust='%d'", service.GetHelmDepName(), now.Unix())
-			fullcommand = append(fullcommand, strings.Split(chunk, " ")...)
-		}
+	// Add the values
+	valueArgs, valueOpts, cleanup, err := b.helmValueArgs(true)
+	if err != nil {
+		return nil, err
 	}
+	defer cleanup()
+	fullcommand = append(fullcommand, valueArgs...)
 
 	// Add the namespace if there is one.
 	if namespace != "" {
-		chunk := fmt.Sprintf("--namespace %s", namespace)
-		fullcommand = append(fullcommand, strings.Split(chunk, " ")...)
+		fullcommand = append(fullcommand, "--namespace", namespace)
 	}
 
 	// Add a longer timeout
 	if b.is2() {
-		chunk := "--timeout 1800 --wait"
-		fullcommand = append(fullcommand, strings.Split(chunk, " ")...)
+		fullcommand = append(fullcommand, "--timeout", "1800", "--wait")
 	} else {
-		chunk := "--timeout 1800s --wait"
-		fullcommand = append(fullcommand, strings.Split(chunk, " ")...)
+		fullcommand = append(fullcommand, "--timeout", "1800s", "--wait")
 	}
 
 	// Add additional helm flags
@@ -79,8 +54,7 @@ func (b *Boondoggle) DoUpgrade(namespace string, release string, dryRun bool, us
 	// Add Tiller namespace
 	if b.is2() {
 		if tillerNamespace != "kube-system" {
-			chunk := fmt.Sprintf("--tiller-namespace %s", tillerNamespace)
-			fullcommand = append(fullcommand, strings.Split(chunk, " ")...)
+			fullcommand = append(fullcommand, "--tiller-namespace", tillerNamespace)
 		}
 	}
 
@@ -99,30 +73,54 @@ func (b *Boondoggle) DoUpgrade(namespace string, release string, dryRun bool, us
 		fullcommand = append([]string{"secrets"}, fullcommand...)
 	}
 
-	cmd := exec.Command("helm", fullcommand...)
+	cmd := NewCommand("helm", fullcommand...)
 
 	// Run the command
 	if !dryRun {
 		b.L.Print("Installing the environment...")
+		if b.useHelmSDK() {
+			if useSecrets {
+				return nil, fmt.Errorf("the helm secrets plugin can not be used with the sdk helm backend")
+			}
+			return b.sdkUpgrade(namespace, release, valueOpts)
+		}
 		if b.Verbose {
 			b.L.Print(Format(Cyan, "Command: "+cmd.String()))
 		}
-		out, err := cmd.CombinedOutput()
+		out, err := b.R.CombinedOutput(cmd)
 		return out, err
 	}
 
-	return []byte(fmt.Sprintf("%s", cmd.Args)), nil
+	out := fmt.Sprintf("[%s]", cmd.String())
+	if valueOpts.Generated != "" {
+		// Print the generated values file, as it is removed once this returns.
+		content, err := ioutil.ReadFile(valueOpts.Generated)
+		if err != nil {
+			return nil, err
+		}
+		out += fmt.Sprintf("\n%s:\n%s", valueOpts.Generated, content)
+	}
+	return []byte(out), nil
 
 }
 
 //DepUp runs "helm dependency update".
 func (b *Boondoggle) DepUp() error {
 	b.L.Print("Updating dependencies...")
-	cmd := exec.Command("helm", "dep", "up", b.Umbrella.Path)
-	if b.Verbose {
-		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	var out []byte
+	var err error
+	if b.useHelmSDK() {
+		if b.Verbose {
+			b.L.Print(Format(Cyan, "Helm SDK: dependency update of "+b.Umbrella.Path))
+		}
+		out, err = b.sdkDepUp()
+	} else {
+		cmd := NewCommand("helm", "dep", "up", b.Umbrella.Path)
+		if b.Verbose {
+			b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+		}
+		out, err = b.R.CombinedOutput(cmd)
 	}
-	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("there was an error updating the dependencies on the umbrella: %s", err)
 	}
@@ -133,92 +131,269 @@ func (b *Boondoggle) DepUp() error {
 	return nil
 }
 
+// helmValueArgs returns the helm flags for the values of the umbrella and the services, and the same values for the helm SDK.
+// The cache buster makes helm upgrade the services in localdev even if nothing else changed.
+// With MergeValues, the values of the services and the --set values are merged into one values file instead, which is
+// the last of the value files.
+// The returned func removes the values file generated for the services, once helm is done.
+func (b *Boondoggle) helmValueArgs(cacheBust bool) ([]string, helmValues, func(), error) {
+	var fullcommand []string
+	var valueOpts helmValues
+	cleanup := func() {}
+
+	// Add files from the umbrella declartion
+	for _, file := range b.Umbrella.Files {
+		valueFile := fmt.Sprintf("%s/%s", b.Umbrella.Path, file)
+		fullcommand = append(fullcommand, "-f", valueFile)
+		valueOpts.ValueFiles = append(valueOpts.ValueFiles, valueFile)
+	}
+
+	var setArgs []string
+	var setOpts helmValues
+
+	//Set global.projectLocation to the location of the boondoggle.yaml file.
+	//This can be used to map volumes for local dev.
+	projectLocation := "global.projectLocation=" + os.Getenv("PWD")
+	setArgs = append(setArgs, "--set", projectLocation)
+	setOpts.add("--set", projectLocation)
+
+	// Add values from the umbrella declaration
+	for _, value := range b.Umbrella.Values {
+		setArgs = append(setArgs, "--set-string", value)
+		setOpts.add("--set-string", value)
+	}
+
+	// Add values from each service, append the service's chart name(or alias if supplied)
+	for _, service := range b.Services {
+		for _, servicevalue := range service.HelmValues {
+			flag, chunk := servicevalue.setArg(service.GetHelmDepName() + ".")
+			setArgs = append(setArgs, flag, chunk)
+			setOpts.add(flag, chunk)
+		}
+	}
+
+	// For services running in local dev, add the cachebuster
+	for _, service := range b.Services {
+		if cacheBust && service.Repository == "localdev" {
+			now := time.Now()
+			chunk := fmt.Sprintf("%s.boondoggleCacheBust=%d", service.GetHelmDepName(), now.Unix())
+			setArgs = append(setArgs, "--set-string", chunk)
+			setOpts.add("--set-string", chunk)
+		}
+	}
+
+	// Add the values-files of the services, after the ones of the umbrella
+	generated, err := b.servicesValues()
+	if err != nil {
+		return nil, valueOpts, cleanup, err
+	}
+	if b.MergeValues {
+		// The --set values are merged the way helm does, over the values-files of the services.
+		setValues, err := setOpts.MergeValues(getter.Providers{})
+		if err != nil {
+			return nil, valueOpts, cleanup, fmt.Errorf("error merging the helm values: %s", err)
+		}
+		generated = mergeMaps(generated, setValues)
+		setArgs, setOpts = nil, helmValues{}
+	}
+	if len(generated) > 0 {
+		file, err := writeValuesFile(generated)
+		if err != nil {
+			return nil, valueOpts, cleanup, err
+		}
+		fullcommand = append(fullcommand, "-f", file)
+		valueOpts.ValueFiles = append(valueOpts.ValueFiles, file)
+		valueOpts.Generated = file
+		cleanup = func() { os.Remove(file) }
+	}
+
+	fullcommand = append(fullcommand, setArgs...)
+	valueOpts.Values = setOpts.Values
+	valueOpts.StringValues = setOpts.StringValues
+	valueOpts.FileValues = setOpts.FileValues
+	valueOpts.JSONValues = setOpts.JSONValues
+	return fullcommand, valueOpts, cleanup, nil
+}
+
 /*
 AddHelmRepos uses `helm repo add` to setup the repos listed in boondoggle config.
 If promtbasicauth is true, it will prompt the user for the helm repo username and password.
 If "username" and "password" are provided, it will use these as the basic auth username and password. environment var replacement is supported for these.
 If the result for the environment variable lookup is empty, it will fall back to prompting for username and password.
-It will not do anything if the repo is already added.
+Repos are compared by exact name with the repos in helm's repositories.yaml.
+It will not do anything if the repo is already added with the same url and credentials, otherwise the repo is updated.
 */
 func (b *Boondoggle) AddHelmRepos() error {
-	cmd := exec.Command("helm", "repo", "list")
-	if b.Verbose {
-		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
-	}
-	out, _ := cmd.CombinedOutput()
-	if b.Verbose {
-		b.L.Print(string(out))
+	existing, err := b.existingHelmRepos()
+	if err != nil {
+		return err
 	}
 	b.L.Print("Adding helm repos...")
 	for _, repo := range b.HelmRepos {
-		// Not the best implementation, but helm does not have a json output for helm repo list.
-		// If the output of "helm repo list" does not contain the repo name(by basic string search), add it.
-		if !strings.Contains(string(out), repo.Name) {
-			if repo.Promptbasicauth { //if the repo requires username and password, prompt for that.
-
-				// get the username either from user input or from boondoggle.yml
-				var username string
-				if repo.Username == "" {
-					fmt.Printf("Enter the username for repo %s: \n", repo.Name)
-					_, err := fmt.Scanln(&username)
-					if err != nil {
-						return fmt.Errorf("error with collecting username for helm chart repo: %s", err)
-					}
-				} else {
-					username = repo.Username
-				}
+		repo, err := b.resolveRepo(repo)
+		if err != nil {
+			return err
+		}
+		current, found := existing[repo.Name]
+		if found && !repoChanged(current, repo) {
+			continue
+		}
+		if found {
+			b.L.Print("The url or credentials of helm repo " + repo.Name + " changed. updating.")
+		}
 
-				// get the password either from user input or from boondoggle.yml
-				var password string
-				if repo.Password == "" {
-					fmt.Printf("Enter the password for %s: \n", username)
-					bytePassword, err := sshterminal.ReadPassword(0)
-					if err != nil {
-						return fmt.Errorf("error with collecting password for helm chart repo: %s", err)
-					}
-					password = string(bytePassword)
-				} else {
-					password = repo.Password
-				}
+		u, err := url.Parse(repo.URL)
+		if err != nil {
+			return fmt.Errorf("error parsing the url of the chart repo: %s", err)
+		}
 
-				u, err := url.Parse(repo.URL)
-				if err != nil {
-					return fmt.Errorf("error parsing the url of the chart repo when attempting to add to helm: %s", err)
-				}
+		if repo.Promptbasicauth { //if the repo requires username and password, prompt for that.
 
-				//Add the basic auth username and password to the URL.
-				u.User = url.UserPassword(username, password)
-				repoadd(repo.Name, u, b.Verbose, b.L)
-			} else { // else, add without the prompt for username and password.
-				u, err := url.Parse(repo.URL)
+			// get the username either from user input or from boondoggle.yml
+			username := repo.Username
+			if username == "" {
+				username, err = b.prompt(helmRepoKey(repo.Name, "username"), fmt.Sprintf("Enter the username for repo %s: ", repo.Name), false)
 				if err != nil {
-					return fmt.Errorf("error parsing the url of the chart repo: %s", err)
+					return fmt.Errorf("error with collecting username for helm chart repo: %w", err)
 				}
-				err = repoadd(repo.Name, u, b.Verbose, b.L)
+			}
+
+			// get the password either from user input or from boondoggle.yml
+			password := repo.Password
+			if password == "" {
+				password, err = b.prompt(helmRepoKey(repo.Name, "password"), fmt.Sprintf("Enter the password for %s: ", username), true)
 				if err != nil {
-					return fmt.Errorf("error when trying to add a chart repo to helm registry: %s", err)
+					return fmt.Errorf("error with collecting password for helm chart repo: %w", err)
 				}
 			}
+
+			//Add the basic auth username and password to the URL.
+			u.User = url.UserPassword(username, password)
 		}
+
+		err = b.repoadd(repo.Name, u, found)
+		if err != nil {
+			return fmt.Errorf("error when trying to add a chart repo to helm registry: %s", err)
+		}
+	}
+	return nil
+}
+
+// existingHelmRepos returns the repos in helm's repositories.yaml by name.
+func (b *Boondoggle) existingHelmRepos() (map[string]*repo.Entry, error) {
+	path := b.helmRepoConfig()
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Reading helm repos from "+path))
+	}
+	f, err := loadRepoFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the helm repositories file: %s", err)
+	}
+	existing := make(map[string]*repo.Entry)
+	for _, entry := range f.Repositories {
+		existing[entry.Name] = entry
+	}
+	return existing, nil
+}
+
+// helmRepoConfig is the location of helm's repositories.yaml.
+func (b *Boondoggle) helmRepoConfig() string {
+	if b.is2() {
+		helmHome := os.Getenv("HELM_HOME")
+		if helmHome == "" {
+			home, _ := os.UserHomeDir()
+			helmHome = filepath.Join(home, ".helm")
+		}
+		return filepath.Join(helmHome, "repository", "repositories.yaml")
+	}
+	return b.helmSettings("").RepositoryConfig
+}
+
+// loadRepoFile reads a helm repositories.yaml. A missing file is an empty list of repos.
+func loadRepoFile(path string) (*repo.File, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return repo.NewFile(), nil
+	}
+	return repo.LoadFile(path)
+}
+
+// repoChanged compares a repo in helm's repositories.yaml with the one in boondoggle config.
+// The credentials are only compared when boondoggle config has them, otherwise they would be prompted for.
+func repoChanged(current *repo.Entry, want HelmRepo) bool {
+	currentURL, err := url.Parse(current.URL)
+	if err != nil {
+		return true
+	}
+	username, password := current.Username, current.Password
+	if currentURL.User != nil {
+		// boondoggle adds basic auth to the url when it uses the helm binary.
+		username = currentURL.User.Username()
+		password, _ = currentURL.User.Password()
+		currentURL.User = nil
+	}
+	if strings.TrimSuffix(currentURL.String(), "/") != strings.TrimSuffix(want.URL, "/") {
+		return true
+	}
+	if !want.Promptbasicauth {
+		return username != "" || password != ""
+	}
+	return (want.Username != "" && want.Username != username) || (want.Password != "" && want.Password != password)
+}
+
+// UpdateHelmRepos runs `helm repo update` for the repos listed in boondoggle config.
+func (b *Boondoggle) UpdateHelmRepos() error {
+	b.L.Print("Updating helm repos...")
+	if b.useHelmSDK() {
+		return b.sdkRepoUpdate()
+	}
+	fullcommand := []string{"repo", "update"}
+	// helm 2 can only update every repo.
+	if !b.is2() {
+		for _, repo := range b.HelmRepos {
+			fullcommand = append(fullcommand, repo.Name)
+		}
+	}
+	cmd := NewCommand("helm", fullcommand...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.CombinedOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("error updating the helm repos: %s", string(out))
+	}
+	if b.Verbose {
+		b.L.Print(string(out))
 	}
 	return nil
 }
 
-func repoadd(name string, u *url.URL, verbose bool, logger LogPrinter) error {
+// repoadd adds a repo to helm. With update, an existing repo with the same name is replaced.
+func (b *Boondoggle) repoadd(name string, u *url.URL, update bool) error {
+	if b.useHelmSDK() {
+		err := b.sdkRepoAdd(name, u)
+		if err != nil {
+			return fmt.Errorf("error adding a repo to the helm repository: %s", err)
+		}
+		return nil
+	}
 	fullcommand := []string{"repo", "add", name, u.String()}
-	if verbose {
+	// helm 2 always replaces an existing repo.
+	if update && !b.is2() {
+		fullcommand = append(fullcommand, "--force-update")
+	}
+	if b.Verbose {
 		fullcommand = append(fullcommand, "--debug")
 	}
-	cmd := exec.Command("helm", fullcommand...)
-	if verbose {
-		logger.Print(Format(Cyan, "Command: "+cmd.String()))
+	cmd := NewCommand("helm", fullcommand...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+b.redacted(strings.Replace(cmd.String(), u.String(), u.Redacted(), 1))))
 	}
-	out, err := cmd.CombinedOutput()
+	out, err := b.R.CombinedOutput(cmd)
 	if err != nil {
-		return fmt.Errorf("error adding a repo to the helm repository: %s", string(out))
+		return fmt.Errorf("error adding a repo to the helm repository: %s", b.redacted(string(out)))
 	}
-	if verbose {
-		logger.Print(string(out))
+	if b.Verbose {
+		b.L.Print(b.redacted(string(out)))
 	}
 	return nil
 }
@@ -226,17 +401,24 @@ func repoadd(name string, u *url.URL, verbose bool, logger LogPrinter) error {
 // SelfFetch will fetch the umbrella chart listed in the boondoggle.yml file.
 func (b *Boondoggle) SelfFetch(path string, version string) error {
 	cleanRepo := strings.TrimPrefix(b.Umbrella.Repository, "@")
-	var fetchcommand string
-	if version == "" {
-		fetchcommand = fmt.Sprintf("fetch %s/%s --untar -d %s", cleanRepo, b.Umbrella.Name, path)
-	} else {
-		fetchcommand = fmt.Sprintf("fetch %s/%s --untar --version=%s -d %s", cleanRepo, b.Umbrella.Name, version, path)
+	fetchcommand := []string{"fetch", cleanRepo + "/" + b.Umbrella.Name, "--untar"}
+	if version != "" {
+		fetchcommand = append(fetchcommand, "--version="+version)
+	}
+	fetchcommand = append(fetchcommand, "-d", path)
+	cmd := NewCommand("helm", fetchcommand...)
+	if b.useHelmSDK() {
+		b.L.Print("Fetching the umbrella...")
+		err := b.sdkFetch(cleanRepo+"/"+b.Umbrella.Name, path, version)
+		if err != nil {
+			return fmt.Errorf("error with self fetch: %s", err)
+		}
+		return nil
 	}
-	cmd := exec.Command("helm", strings.Split(fetchcommand, " ")...)
 	if b.Verbose {
 		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
 	}
-	out, err := cmd.CombinedOutput()
+	out, err := b.R.CombinedOutput(cmd)
 	b.L.Print("Fetching the umbrella...")
 	if b.Verbose {
 		b.L.Print(string(out))
@@ -250,3 +432,52 @@ func (b *Boondoggle) SelfFetch(path string, version string) error {
 func (b Boondoggle) is2() bool {
 	return b.HelmVersion == 2
 }
+
+// DoUninstall builds and runs the helm command that removes the release.
+func (b *Boondoggle) DoUninstall(namespace string, release string, dryRun bool, tls bool, tillerNamespace string) ([]byte, error) {
+	var fullcommand []string
+	if b.is2() {
+		fullcommand = []string{"delete", "--purge", release}
+	} else {
+		fullcommand = []string{"uninstall", release}
+	}
+
+	// Add the namespace if there is one. Helm 2 releases are not namespaced.
+	if !b.is2() && namespace != "" {
+		fullcommand = append(fullcommand, "--namespace", namespace)
+	}
+
+	// Add Tiller namespace and tls flag
+	if b.is2() {
+		if tillerNamespace != "kube-system" {
+			fullcommand = append(fullcommand, "--tiller-namespace", tillerNamespace)
+		}
+		if tls {
+			fullcommand = append(fullcommand, "--tls")
+		}
+	}
+
+	if b.SuperSecret {
+		fullcommand = append(fullcommand, "--debug")
+	}
+
+	cmd := NewCommand("helm", fullcommand...)
+
+	// Run the command
+	if !dryRun {
+		b.L.Print("Uninstalling the release...")
+		if b.useHelmSDK() {
+			return b.sdkUninstall(namespace, release)
+		}
+		if b.Verbose {
+			b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+		}
+		out, err := b.R.CombinedOutput(cmd)
+		if err != nil && strings.Contains(string(out), "not found") {
+			return []byte(fmt.Sprintf("Release %s not found. skipping.", release)), nil
+		}
+		return out, err
+	}
+
+	return []byte(fmt.Sprintf("[%s]", cmd.String())), nil
+}
@@ -0,0 +1,225 @@
+package boondoggle
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+//This file contains the in-process helm backend, used instead of the helm binary when helmBackend is "sdk".
+
+const (
+	// HelmBackendCLI runs the helm binary. This is the default.
+	HelmBackendCLI = "cli"
+	// HelmBackendSDK runs helm in-process with the Helm v3 Go SDK.
+	HelmBackendSDK = "sdk"
+)
+
+func (b Boondoggle) useHelmSDK() bool {
+	return b.HelmBackend == HelmBackendSDK
+}
+
+// helmSettings returns the helm environment settings, read from the same HELM_* env vars as the helm binary.
+func (b *Boondoggle) helmSettings(namespace string) *cli.EnvSettings {
+	settings := cli.New()
+	settings.Debug = b.SuperSecret
+	if namespace != "" {
+		// The namespace can only be set through the flags of the settings.
+		flags := pflag.NewFlagSet("helm", pflag.ContinueOnError)
+		settings.AddFlags(flags)
+		flags.Set("namespace", namespace)
+	}
+	return settings
+}
+
+// helmActionConfig returns the configuration used by the helm actions that talk to the cluster.
+func (b *Boondoggle) helmActionConfig(settings *cli.EnvSettings) (*action.Configuration, error) {
+	cfg := new(action.Configuration)
+	err := cfg.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER"), func(format string, v ...interface{}) {
+		if b.Verbose {
+			b.L.Print(fmt.Sprintf(format, v...))
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error configuring helm: %s", err)
+	}
+	return cfg, nil
+}
+
+// sdkUpgrade is the in-process version of "helm upgrade -i".
+func (b *Boondoggle) sdkUpgrade(namespace string, release string, valueOpts helmValues) ([]byte, error) {
+	settings := b.helmSettings(namespace)
+	cfg, err := b.helmActionConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := valueOpts.MergeValues(getter.All(settings))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the helm values: %s", err)
+	}
+
+	chart, err := loader.Load(b.Umbrella.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the umbrella chart: %s", err)
+	}
+	if chart.Metadata.Dependencies != nil {
+		err = action.CheckDependencies(chart, chart.Metadata.Dependencies)
+		if err != nil {
+			return nil, fmt.Errorf("the umbrella dependencies are not up to date: %s", err)
+		}
+	}
+
+	// If the release does not exist, install it.
+	history := action.NewHistory(cfg)
+	history.Max = 1
+	_, err = history.Run(release)
+	if err == driver.ErrReleaseNotFound {
+		install := action.NewInstall(cfg)
+		install.ReleaseName = release
+		install.Namespace = settings.Namespace()
+		install.Timeout = 1800 * time.Second
+		install.Wait = true
+		rel, err := install.Run(chart, vals)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(fmt.Sprintf("Release %q has been installed. Revision: %d, status: %s", rel.Name, rel.Version, rel.Info.Status)), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	upgrade := action.NewUpgrade(cfg)
+	upgrade.Namespace = settings.Namespace()
+	upgrade.Timeout = 1800 * time.Second
+	upgrade.Wait = true
+	rel, err := upgrade.Run(release, chart, vals)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("Release %q has been upgraded. Revision: %d, status: %s", rel.Name, rel.Version, rel.Info.Status)), nil
+}
+
+// sdkUninstall is the in-process version of "helm uninstall".
+func (b *Boondoggle) sdkUninstall(namespace string, release string) ([]byte, error) {
+	cfg, err := b.helmActionConfig(b.helmSettings(namespace))
+	if err != nil {
+		return nil, err
+	}
+	res, err := action.NewUninstall(cfg).Run(release)
+	if err == driver.ErrReleaseNotFound {
+		return []byte(fmt.Sprintf("Release %s not found. skipping.", release)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("Release %q uninstalled. %s", release, res.Info)), nil
+}
+
+// sdkDepUp is the in-process version of "helm dependency update".
+func (b *Boondoggle) sdkDepUp() ([]byte, error) {
+	settings := b.helmSettings("")
+	var out bytes.Buffer
+	manager := downloader.Manager{
+		Out:              &out,
+		ChartPath:        b.Umbrella.Path,
+		Getters:          getter.All(settings),
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+		Debug:            settings.Debug,
+	}
+	err := manager.Update()
+	return out.Bytes(), err
+}
+
+// sdkRepoAdd is the in-process version of "helm repo add". Basic auth in the url is stored as the username and password of the repo.
+func (b *Boondoggle) sdkRepoAdd(name string, u *url.URL) error {
+	settings := b.helmSettings("")
+	entry := repo.Entry{Name: name}
+	if u.User != nil {
+		entry.Username = u.User.Username()
+		entry.Password, _ = u.User.Password()
+		withoutUser := *u
+		withoutUser.User = nil
+		u = &withoutUser
+	}
+	entry.URL = u.String()
+
+	chartRepo, err := repo.NewChartRepository(&entry, getter.All(settings))
+	if err != nil {
+		return err
+	}
+	chartRepo.CachePath = settings.RepositoryCache
+	_, err = chartRepo.DownloadIndexFile()
+	if err != nil {
+		return fmt.Errorf("%s does not look like a valid chart repository: %s", u.String(), err)
+	}
+
+	f, err := loadRepoFile(settings.RepositoryConfig)
+	if err != nil {
+		return err
+	}
+	f.Update(&entry)
+	err = os.MkdirAll(filepath.Dir(settings.RepositoryConfig), 0755)
+	if err != nil {
+		return err
+	}
+	return f.WriteFile(settings.RepositoryConfig, 0644)
+}
+
+// sdkRepoUpdate is the in-process version of "helm repo update" for the repos listed in boondoggle config.
+func (b *Boondoggle) sdkRepoUpdate() error {
+	settings := b.helmSettings("")
+	f, err := loadRepoFile(settings.RepositoryConfig)
+	if err != nil {
+		return err
+	}
+	for _, helmRepo := range b.HelmRepos {
+		entry := f.Get(helmRepo.Name)
+		if entry == nil {
+			return fmt.Errorf("helm repo %s has not been added", helmRepo.Name)
+		}
+		chartRepo, err := repo.NewChartRepository(entry, getter.All(settings))
+		if err != nil {
+			return err
+		}
+		chartRepo.CachePath = settings.RepositoryCache
+		_, err = chartRepo.DownloadIndexFile()
+		if err != nil {
+			return fmt.Errorf("error updating helm repo %s: %s", helmRepo.Name, err)
+		}
+	}
+	return nil
+}
+
+// sdkFetch is the in-process version of "helm fetch --untar".
+func (b *Boondoggle) sdkFetch(chartRef string, path string, version string) error {
+	settings := b.helmSettings("")
+	cfg, err := b.helmActionConfig(settings)
+	if err != nil {
+		return err
+	}
+	pull := action.NewPullWithOpts(action.WithConfig(cfg))
+	pull.Settings = settings
+	pull.Untar = true
+	pull.UntarDir = path
+	pull.DestDir = path
+	pull.Version = version
+	out, err := pull.Run(chartRef)
+	if b.Verbose {
+		b.L.Print(out)
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package boondoggle
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSDKAddHelmRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-helmsdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(dir, "repositories.yaml"))
+	os.Setenv("HELM_REPOSITORY_CACHE", filepath.Join(dir, "cache"))
+	defer os.Unsetenv("HELM_REPOSITORY_CONFIG")
+	defer os.Unsetenv("HELM_REPOSITORY_CACHE")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+	}))
+	defer server.Close()
+
+	b := Boondoggle{
+		L:           log.New(ioutil.Discard, "", 0),
+		R:           &FakeRunner{},
+		HelmBackend: HelmBackendSDK,
+		HelmRepos: []HelmRepo{
+			{Name: "private", URL: server.URL, Promptbasicauth: true, Username: "user", Password: "pass"},
+		},
+	}
+	err = b.AddHelmRepos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := b.existingHelmRepos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing["private"] == nil || existing["private"].URL != server.URL || existing["private"].Username != "user" {
+		t.Error("Expected the repo to be added without credentials in the url, got:", existing["private"])
+	}
+	if len(b.R.(*FakeRunner).Calls) != 0 {
+		t.Error("Expected the helm binary not to be used, got:", b.R.(*FakeRunner).CommandLines())
+	}
+}
@@ -1,122 +1,312 @@
 package boondoggle
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os/exec"
+	"reflect"
 	"strings"
-
-	sshterminal "golang.org/x/crypto/ssh/terminal"
 )
 
-//AddImagePullSecret ensures the kubernetes imagePullSecret is set with kubectl.
-func (b *Boondoggle) AddImagePullSecret(namespace string) error {
-	if b.PullSecretsName != "" { // if boondoggle config specifies a pullsecretsname
+// DockerHub is the server of the docker_username, docker_password and docker_email credentials when docker_server is not set.
+const DockerHub = "https://index.docker.io/v1/"
 
-		err := b.CreateNamespaceIfNotExists(namespace)
-		if err != nil {
-			b.L.Print(err.Error())
-		}
+// PullSecret is a kubernetes image pull secret with the credentials of one or more docker registries.
+type PullSecret struct {
+	Name       string
+	Registries []RegistryCredential
+	// PatchServiceAccount adds the secret to the imagePullSecrets of the default service account of the namespace.
+	PatchServiceAccount bool
+}
 
-		// Determine if it's already set up.
-		in := fmt.Sprintf("get secrets %s", b.PullSecretsName)
-		inslice := strings.Split(in, " ")
+// RegistryCredential is the credentials of a docker registry in a PullSecret.
+type RegistryCredential struct {
+	Server   string
+	Username string
+	Password string
+	Email    string
+	// KeyPrefix makes the config key of each credential, for the prompts and errors, eg. "docker_" for "docker_password".
+	KeyPrefix string
+}
 
-		// If a namesapce was provided in the "up" command, include the namespace in the check.
-		// Add the namespace if there is one.
-		if namespace != "" {
-			chunk := fmt.Sprintf("--namespace %s", namespace)
-			inslice = append(inslice, strings.Split(chunk, " ")...)
-		}
+// dockerConfigJSON is the content of a kubernetes.io/dockerconfigjson secret.
+type dockerConfigJSON struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
 
-		cmd := exec.Command("kubectl", inslice...)
-		out, err := cmd.CombinedOutput()
+type dockerAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth"`
+}
 
-		if err != nil && strings.Contains(string(out), "NotFound") {
-			// if there was an error and the output of the command contains "NotFound", setup the credentials
+// allPullSecrets returns the pull-secrets-name secret followed by the pull-secrets.
+func (b *Boondoggle) allPullSecrets() []PullSecret {
+	if b.PullSecretsName == "" {
+		return b.PullSecrets
+	}
+	server := b.DockerServer
+	if server == "" {
+		server = DockerHub
+	}
+	pullSecret := PullSecret{Name: b.PullSecretsName, PatchServiceAccount: b.PatchDefaultSA}
+	pullSecret.Registries = append(pullSecret.Registries, RegistryCredential{
+		Server:    server,
+		Username:  b.DockerUsername,
+		Password:  b.DockerPassword,
+		Email:     b.DockerEmail,
+		KeyPrefix: "docker_",
+	})
+	pullSecret.Registries = append(pullSecret.Registries, b.ExtraRegistries...)
+	return append([]PullSecret{pullSecret}, b.PullSecrets...)
+}
 
-			var email string
-			if b.DockerEmail == "" {
-				fmt.Println("You need to set up docker hub integration with kubernetes.")
-				fmt.Println("Please enter your docker hub EMAIL ADDRESS:")
-				_, err := fmt.Scanln(&email)
-				if err != nil {
-					return fmt.Errorf("error with kubectl create secret: %s", err)
-				}
-			} else {
-				email = b.DockerEmail
-			}
+/*
+AddImagePullSecret ensures the kubernetes image pull secrets exist in namespace, with the credentials in boondoggle.yml.
+The secrets are applied as kubernetes.io/dockerconfigjson manifests on the stdin of kubectl, so the passwords are not
+on the command line. A secret whose credentials changed is updated. If a secret does not exist yet and credentials are
+missing from boondoggle.yml, they are prompted for, otherwise an existing secret is left alone.
+With dryRun, each secret is reported as already present, to be created or to be updated, and nothing is changed.
+*/
+func (b *Boondoggle) AddImagePullSecret(namespace string, dryRun bool) error {
+	pullSecrets := b.allPullSecrets()
+	if len(pullSecrets) == 0 {
+		return nil
+	}
 
-			var username string
-			if b.DockerUsername == "" {
-				fmt.Println("Please enter your docker hub USERNAME:")
-				_, err = fmt.Scanln(&username)
-				if err != nil {
-					return fmt.Errorf("error with kubectl create secret: %s", err)
-				}
-			} else {
-				username = b.DockerUsername
-			}
+	if !dryRun {
+		err := b.CreateNamespaceIfNotExists(namespace)
+		if err != nil {
+			b.L.Print(err.Error())
+		}
+	}
 
-			var password []byte
-			if b.DockerPassword == "" {
-				fmt.Println("Please enter your docker hub PASSWORD:")
-				password, err = sshterminal.ReadPassword(0)
-				if err != nil {
-					return fmt.Errorf("error with kubectl create secret: %s", err)
-				}
-			} else {
-				password = []byte(b.DockerPassword)
+	for _, pullSecret := range pullSecrets {
+		err := b.applyPullSecret(namespace, pullSecret, dryRun)
+		if err != nil {
+			return err
+		}
+		if pullSecret.PatchServiceAccount && !dryRun {
+			err = b.patchServiceAccount(namespace, pullSecret.Name)
+			if err != nil {
+				return err
 			}
+		}
+	}
+	return nil
+}
 
-			in := fmt.Sprintf("create secret docker-registry %s --docker-username=%s --docker-password=%s --docker-email=%s", b.PullSecretsName, username, password, email)
-			inslice := strings.Split(in, " ")
+// applyPullSecret creates or updates one image pull secret.
+func (b *Boondoggle) applyPullSecret(namespace string, pullSecret PullSecret, dryRun bool) error {
+	current, found, err := b.getPullSecret(namespace, pullSecret.Name)
+	if err != nil {
+		return err
+	}
+	config, complete, err := b.pullSecretConfig(pullSecret, !found && !dryRun)
+	if err != nil {
+		return fmt.Errorf("error with kubectl create secret: %w", err)
+	}
+	switch {
+	case found && !complete:
+		b.L.Print("Secret " + pullSecret.Name + " already exists and its credentials are not all in boondoggle.yml. skipping.")
+		return nil
+	case found && reflect.DeepEqual(current, config):
+		b.L.Print("Secret " + pullSecret.Name + " already exists and is up to date. skipping.")
+		return nil
+	case dryRun && found:
+		b.L.Print(Format(Cyan, "Dry run: secret "+pullSecret.Name+" would be updated"))
+		return nil
+	case dryRun:
+		b.L.Print(Format(Cyan, "Dry run: secret "+pullSecret.Name+" would be created"))
+		return nil
+	}
 
-			// If a namesapce was provided in the "up" command, include the namespace when creating the secret.
-			// Add the namespace if there is one.
-			if namespace != "" {
-				chunk := fmt.Sprintf("--namespace %s", namespace)
-				inslice = append(inslice, strings.Split(chunk, " ")...)
-			}
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "kubernetes.io/dockerconfigjson",
+		"metadata":   map[string]string{"name": pullSecret.Name},
+		"data":       map[string]string{".dockerconfigjson": base64.StdEncoding.EncodeToString(configBytes)},
+	})
+	if err != nil {
+		return err
+	}
+	cmd := NewCommand("kubectl", withNamespace([]string{"apply", "-f", "-"}, namespace)...)
+	cmd.Stdin = bytes.NewReader(manifest)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.CombinedOutput(cmd)
+	if b.Verbose {
+		b.L.Print(b.redacted(string(out)))
+	}
+	if err != nil {
+		return fmt.Errorf("error with kubectl apply secret %s: %s", pullSecret.Name, b.redacted(string(out)))
+	}
+	if found {
+		b.L.Print("Secret " + pullSecret.Name + " updated")
+	} else {
+		b.L.Print("Secret " + pullSecret.Name + " created")
+	}
+	return nil
+}
 
-			cmd := exec.Command("kubectl", inslice...)
-			if b.Verbose {
-				b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+// getPullSecret reads the docker config of an existing image pull secret.
+// A secret of another type has an empty config, so it is replaced.
+func (b *Boondoggle) getPullSecret(namespace string, name string) (dockerConfigJSON, bool, error) {
+	var config dockerConfigJSON
+	cmd := NewCommand("kubectl", withNamespace([]string{"get", "secret", name, "-o", "json"}, namespace)...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	// The secret is read from stdout only, so a warning of kubectl on stderr does not break the JSON.
+	out, err := b.R.Output(cmd)
+	if err != nil {
+		// ExecRunner keeps stderr in the exec.ExitError.
+		combined := string(out)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			combined += string(exitErr.Stderr)
+		}
+		if strings.Contains(combined, "NotFound") {
+			return config, false, nil
+		}
+		return config, false, fmt.Errorf("error with kubectl get: %s: %s", err, strings.TrimSpace(combined))
+	}
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(out, &secret); err != nil {
+		return config, true, fmt.Errorf("error reading secret %s: %s", name, err)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(secret.Data[".dockerconfigjson"]); err == nil {
+		json.Unmarshal(decoded, &config)
+	}
+	return config, true, nil
+}
+
+// pullSecretConfig resolves the credentials of each registry of a PullSecret into a docker config.
+// complete is false when a username or password is missing. They are prompted for when prompt is true.
+func (b *Boondoggle) pullSecretConfig(pullSecret PullSecret, prompt bool) (dockerConfigJSON, bool, error) {
+	config := dockerConfigJSON{Auths: map[string]dockerAuth{}}
+	complete := true
+	for i, registry := range pullSecret.Registries {
+		email, err := b.secret(registry.KeyPrefix+"email", SecretEmail, registry.Email)
+		if err != nil {
+			return config, false, err
+		}
+		username, err := b.secret(registry.KeyPrefix+"username", SecretUsername, registry.Username)
+		if err != nil {
+			return config, false, err
+		}
+		if username == "" && prompt {
+			if i == 0 && registry.Server == DockerHub {
+				fmt.Println("You need to set up docker hub integration with kubernetes.")
 			}
-			out, err := cmd.CombinedOutput()
-			if b.Verbose {
-				b.L.Print(string(out))
+			username, err = b.prompt(registry.KeyPrefix+"username", fmt.Sprintf("Please enter your USERNAME for %s:", registry.Server), false)
+			if err != nil {
+				return config, false, err
 			}
+		}
+		password, err := b.secret(registry.KeyPrefix+"password", SecretPassword, registry.Password)
+		if err != nil {
+			return config, false, err
+		}
+		if password == "" && prompt {
+			password, err = b.prompt(registry.KeyPrefix+"password", fmt.Sprintf("Please enter your PASSWORD for %s:", registry.Server), true)
 			if err != nil {
-				return fmt.Errorf("error with kubectl create secret: %s", err)
+				return config, false, err
 			}
-		} else if err != nil { // else if some other error has happened, return the error.
-			return fmt.Errorf("error with kubectl get: %s", err)
 		}
-		// Otherwise it already exists and we do nothing.
+		if username == "" || password == "" {
+			complete = false
+		}
+		config.Auths[registry.Server] = dockerAuth{
+			Username: username,
+			Password: password,
+			Email:    email,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+		}
+	}
+	return config, complete, nil
+}
+
+// patchServiceAccount adds an image pull secret to the default service account of namespace, so pods use it
+// without listing it in their imagePullSecrets.
+func (b *Boondoggle) patchServiceAccount(namespace string, name string) error {
+	cmd := NewCommand("kubectl", withNamespace([]string{"get", "serviceaccount", "default", "-o", "json"}, namespace)...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.Output(cmd)
+	if err != nil {
+		return fmt.Errorf("error with kubectl get serviceaccount: %s", err)
+	}
+	var serviceAccount struct {
+		ImagePullSecrets []map[string]string `json:"imagePullSecrets"`
+	}
+	if err := json.Unmarshal(out, &serviceAccount); err != nil {
+		return fmt.Errorf("error reading the default service account: %s", err)
+	}
+	for _, secret := range serviceAccount.ImagePullSecrets {
+		if secret["name"] == name {
+			return nil
+		}
 	}
+
+	// The imagePullSecrets of a service account are replaced by a patch, not merged.
+	patch, err := json.Marshal(map[string]interface{}{
+		"imagePullSecrets": append(serviceAccount.ImagePullSecrets, map[string]string{"name": name}),
+	})
+	if err != nil {
+		return err
+	}
+	cmd = NewCommand("kubectl", withNamespace([]string{"patch", "serviceaccount", "default", "--type", "merge", "-p", string(patch)}, namespace)...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err = b.R.CombinedOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("error with kubectl patch serviceaccount: %s", string(out))
+	}
+	b.L.Print("Secret " + name + " added to the default service account")
 	return nil
 }
 
+// withNamespace adds the --namespace flag to the arguments of kubectl if there is a namespace.
+func withNamespace(args []string, namespace string) []string {
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	return args
+}
+
 // CreateNamespaceIfNotExists creates a kubernetes namespace if it does not already exist in the cluster.
 func (b *Boondoggle) CreateNamespaceIfNotExists(namespace string) error {
 	// Create the namespace in the cluster if there is one provided
 	if namespace != "" {
 		// check if namespace exists
-		checkNamespace := exec.Command("kubectl", "get", "namespace", namespace)
+		checkNamespace := NewCommand("kubectl", "get", "namespace", namespace)
 		if b.Verbose {
 			b.L.Print(Format(Cyan, "Command: "+checkNamespace.String()))
 		}
-		out, err := checkNamespace.CombinedOutput()
+		out, err := b.R.CombinedOutput(checkNamespace)
 		if b.Verbose {
 			b.L.Print(string(out))
 		}
 		if err != nil && strings.Contains(string(out), "not found") {
 			// if does not exist, create it
-			namespaceCommand := exec.Command("kubectl", "create", "namespace", namespace)
+			namespaceCommand := NewCommand("kubectl", "create", "namespace", namespace)
 			if b.Verbose {
 				b.L.Print(Format(Cyan, "Command: "+namespaceCommand.String()))
 			}
-			out, err := namespaceCommand.CombinedOutput()
+			out, err := b.R.CombinedOutput(namespaceCommand)
 			if err != nil {
 				return fmt.Errorf("WARN: non-existent namespace could not be created")
 			}
@@ -130,3 +320,45 @@ func (b *Boondoggle) CreateNamespaceIfNotExists(namespace string) error {
 	}
 	return nil
 }
+
+// DeleteImagePullSecret removes the kubernetes image pull secrets created by AddImagePullSecret.
+func (b *Boondoggle) DeleteImagePullSecret(namespace string, dryRun bool) error {
+	pullSecrets := b.allPullSecrets()
+	if len(pullSecrets) == 0 {
+		return nil
+	}
+	fullcommand := []string{"delete", "secret"}
+	for _, pullSecret := range pullSecrets {
+		fullcommand = append(fullcommand, pullSecret.Name)
+	}
+	fullcommand = append(fullcommand, "--ignore-not-found")
+	if namespace != "" {
+		fullcommand = append(fullcommand, "--namespace", namespace)
+	}
+	return b.runKubectlDelete(fullcommand, dryRun)
+}
+
+// DeleteNamespace removes a kubernetes namespace and everything in it.
+func (b *Boondoggle) DeleteNamespace(namespace string, dryRun bool) error {
+	if namespace == "" {
+		return fmt.Errorf("a namespace is required to delete the namespace")
+	}
+	return b.runKubectlDelete([]string{"delete", "namespace", namespace, "--ignore-not-found"}, dryRun)
+}
+
+func (b *Boondoggle) runKubectlDelete(fullcommand []string, dryRun bool) error {
+	cmd := NewCommand("kubectl", fullcommand...)
+	if dryRun {
+		b.L.Print(Format(Cyan, "Dry run: "+cmd.String()))
+		return nil
+	}
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.CombinedOutput(cmd)
+	b.L.Print(string(out))
+	if err != nil {
+		return fmt.Errorf("error with kubectl delete: %s", string(out))
+	}
+	return nil
+}
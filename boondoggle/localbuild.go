@@ -1,21 +1,35 @@
 package boondoggle
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"strings"
 )
 
 //DoBuild builds the localdev container based on the command in the boondoggle config file.
+//It stops at the first container-build that fails.
 func (b *Boondoggle) DoBuild() error {
 	for _, service := range b.Services {
-		// Only do these steps if the repo is running locally and a container-build is specified.
-		if service.Repository == "localdev" && service.ContainerBuild != "" {
-			cmdslice := strings.Split(service.ContainerBuild, " ")
-			cmd := exec.Command("docker", cmdslice...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Run()
+		err := b.buildContainer(context.Background(), service, os.Stdout, os.Stderr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildContainer runs the container-build of a service if it is running locally and a container-build is specified.
+func (b *Boondoggle) buildContainer(ctx context.Context, service Service, stdout io.Writer, stderr io.Writer) error {
+	if service.Repository == "localdev" && len(service.ContainerBuild) > 0 {
+		cmd := NewCommand("docker", service.ContainerBuild...)
+		cmd.Context = ctx
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err := b.R.Run(cmd)
+		if err != nil {
+			return exitError("container-build of service "+service.Name, err)
 		}
 	}
 	return nil
@@ -26,11 +40,9 @@ func (b *Boondoggle) DoBuild() error {
 func (b *Boondoggle) DoPreDeploySteps() error {
 	for _, service := range b.Services {
 		if service.Repository == "localdev" && len(service.PreDeploySteps) > 0 {
-			for _, step := range service.PreDeploySteps {
-				cmd := exec.Command(step.Cmd, step.Args...)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				cmd.Run()
+			err := b.runSteps(context.Background(), service, "preDeploySteps", service.PreDeploySteps, os.Stdout, os.Stderr)
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -42,17 +54,41 @@ func (b *Boondoggle) DoPreDeploySteps() error {
 func (b *Boondoggle) DoPostDeploySteps() error {
 	for _, service := range b.Services {
 		if service.Repository == "localdev" && len(service.PostDeploySteps) > 0 {
-			for _, step := range service.PostDeploySteps {
-				cmd := exec.Command(step.Cmd, step.Args...)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				cmd.Run()
+			err := b.runSteps(context.Background(), service, "postDeploySteps", service.PostDeploySteps, os.Stdout, os.Stderr)
+			if err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+// runSteps runs the steps of a service in order.
+// A failing step stops the steps and returns an error, unless the step has continueOnError set.
+func (b *Boondoggle) runSteps(ctx context.Context, service Service, kind string, steps []Step, stdout io.Writer, stderr io.Writer) error {
+	for key, step := range steps {
+		cmd := NewCommand(step.Cmd, step.Args...)
+		cmd.Context = ctx
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.Dir = step.Workdir
+		cmd.Env = step.Env
+		cmd.Timeout = step.Timeout
+		if b.Verbose {
+			b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+		}
+		err := b.R.Run(cmd)
+		if err != nil {
+			stepErr := exitError(fmt.Sprintf("%s[%d] of service %s", kind, key, service.Name), err)
+			if !step.ContinueOnError || ctx.Err() != nil {
+				return stepErr
+			}
+			b.L.Print(Format(Yellow, stepErr.Error()+". continuing."))
+		}
+	}
+	return nil
+}
+
 // DoPostDeployExec runs commands in the app outlined in the boondoggle.yml file for the services with the state set to "localdev"
 func (b *Boondoggle) DoPostDeployExec(namespace string) error {
 	b.L.Print("running post exec...")
@@ -73,18 +109,58 @@ func (b *Boondoggle) DoPostDeployExec(namespace string) error {
 func (b *Boondoggle) runExecCommand(namespace string, appName string, container string, command []string) (string, error) {
 
 	// Get the pod name based on the namespace and the app= tag
-	cmd := exec.Command("kubectl", "get", "pods", "-n", namespace, "-o", "go-template", "--template", "{{(index .items 0).metadata.name}}", "--selector", "app="+appName)
-	b.L.Print(cmd.Args)
-	out, err := cmd.CombinedOutput()
+	cmd := NewCommand("kubectl", "get", "pods", "-n", namespace, "-o", "go-template", "--template", "{{(index .items 0).metadata.name}}", "--selector", "app="+appName)
+	b.L.Print(cmd.String())
+	out, err := b.R.CombinedOutput(cmd)
 	if err != nil {
 		return string(out), err
 	}
 
 	fragmentSlice := []string{"exec", "-n", namespace, "-c", container, string(out), "--"}
 	fragmentSlice = append(fragmentSlice, command...)
-	cmd = exec.Command("kubectl", fragmentSlice...)
-	b.L.Print(cmd.Args)
-	out, err = cmd.CombinedOutput()
+	cmd = NewCommand("kubectl", fragmentSlice...)
+	b.L.Print(cmd.String())
+	out, err = b.R.CombinedOutput(cmd)
 	b.L.Print(string(out))
 	return string(out), err
 }
+
+// RemoveLocalImages removes the images tagged by the container-build of services with the state set to "localdev"
+func (b *Boondoggle) RemoveLocalImages(dryRun bool) error {
+	for _, service := range b.Services {
+		if service.Repository == "localdev" && len(service.ContainerBuild) > 0 {
+			for _, tag := range getBuildTags(service.ContainerBuild) {
+				cmd := NewCommand("docker", "rmi", tag)
+				if dryRun {
+					b.L.Print(Format(Cyan, "Dry run: "+cmd.String()))
+					continue
+				}
+				if b.Verbose {
+					b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+				}
+				out, err := b.R.CombinedOutput(cmd)
+				if err != nil && strings.Contains(string(out), "No such image") {
+					b.L.Print("Image " + tag + " not found. skipping.")
+				} else if err != nil {
+					return fmt.Errorf("error removing image %s for %s: %s", tag, service.Name, string(out))
+				} else {
+					b.L.Print(string(out))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getBuildTags returns the image tags given to a docker build command with -t or --tag.
+func getBuildTags(args []string) []string {
+	var tags []string
+	for key, arg := range args {
+		if (arg == "-t" || arg == "--tag") && key+1 < len(args) {
+			tags = append(tags, args[key+1])
+		} else if strings.HasPrefix(arg, "--tag=") {
+			tags = append(tags, strings.TrimPrefix(arg, "--tag="))
+		}
+	}
+	return tags
+}
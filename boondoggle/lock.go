@@ -0,0 +1,212 @@
+package boondoggle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// LockFileName is the file, next to boondoggle.yml, that holds the resolved version of each dependency.
+const LockFileName = "boondoggle.lock"
+
+// Lock is the boondoggle.lock file. It pins the version ranges of the services to the versions they resolved to.
+type Lock struct {
+	Dependencies []LockedDependency `yaml:"dependencies"`
+}
+
+// LockedDependency is the resolved version of the version range of one state of a service.
+// States of a service that share a repository and a version range share a LockedDependency.
+type LockedDependency struct {
+	Service    string `yaml:"service"`
+	Chart      string `yaml:"chart"`
+	Repository string `yaml:"repository"`
+	Constraint string `yaml:"constraint"`
+	Version    string `yaml:"version"`
+}
+
+// LoadLock reads the boondoggle.lock in dir. A missing file is an empty Lock.
+func LoadLock(dir string) (Lock, error) {
+	var lock Lock
+	lockBytes, err := ioutil.ReadFile(filepath.Join(dir, LockFileName))
+	if os.IsNotExist(err) {
+		return lock, nil
+	} else if err != nil {
+		return lock, fmt.Errorf("error reading %s: %s", LockFileName, err)
+	}
+	err = yaml.Unmarshal(lockBytes, &lock)
+	if err != nil {
+		return lock, fmt.Errorf("error reading %s: %s", LockFileName, err)
+	}
+	return lock, nil
+}
+
+// WriteLock writes the boondoggle.lock in dir.
+func WriteLock(dir string, lock Lock) error {
+	out, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, LockFileName), out, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %s", LockFileName, err)
+	}
+	return nil
+}
+
+// Version returns the locked version of a service with the given version range, or the range if it is not locked.
+func (l Lock) Version(service Service, constraint string) string {
+	for _, dep := range l.Dependencies {
+		if dep.Service == service.Name && dep.Chart == service.Chart && dep.Repository == service.Repository && dep.Constraint == constraint {
+			return dep.Version
+		}
+	}
+	return constraint
+}
+
+/*
+ResolveLock resolves the version range of every state of every service in config that is not localdev,
+against the index.yaml of its helm repo. The versions already in previous are kept, unless update is true.
+Repositories are either the name of a helm repo, as "@name" or "alias:name", or the url of a chart repo.
+*/
+func (b *Boondoggle) ResolveLock(config RawBoondoggle, previous Lock, update bool) (Lock, error) {
+	var lock Lock
+	indexes := map[string]*repo.IndexFile{}
+	var errs []string
+	seen := map[LockedDependency]bool{}
+	for _, rawService := range config.Services {
+		for _, rawState := range rawService.States {
+			if rawState.Repository == "localdev" || rawState.Repository == "" {
+				continue
+			}
+			service := Service{Name: rawService.Name, Chart: rawService.Chart, Repository: rawState.Repository}
+			dep := LockedDependency{Service: service.Name, Chart: service.Chart, Repository: service.Repository, Constraint: rawState.Version}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+
+			// There is no index.yaml for file:// and oci:// repositories, their version range is locked as it is.
+			if !hasIndex(dep.Repository) {
+				dep.Version = dep.Constraint
+				lock.Dependencies = append(lock.Dependencies, dep)
+				continue
+			}
+
+			if !update && isLocked(previous, dep) {
+				dep.Version = previous.Version(service, dep.Constraint)
+				lock.Dependencies = append(lock.Dependencies, dep)
+				continue
+			}
+
+			index, ok := indexes[dep.Repository]
+			if !ok {
+				var err error
+				index, err = b.repoIndex(dep.Repository)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", dep.Service, err))
+					continue
+				}
+				indexes[dep.Repository] = index
+			}
+			chartVersion, err := index.Get(dep.Chart, dep.Constraint)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: no version of %s in %s matches %q", dep.Service, dep.Chart, dep.Repository, dep.Constraint))
+				continue
+			}
+			dep.Version = chartVersion.Version
+			lock.Dependencies = append(lock.Dependencies, dep)
+		}
+	}
+	if len(errs) > 0 {
+		return lock, fmt.Errorf("error resolving the dependency versions:\n  %s", strings.Join(errs, "\n  "))
+	}
+	sort.SliceStable(lock.Dependencies, func(i, j int) bool {
+		return lock.Dependencies[i].Service < lock.Dependencies[j].Service
+	})
+	return lock, nil
+}
+
+// hasIndex tells if a repository is a helm repo or a chart repo url, which have an index.yaml.
+func hasIndex(repository string) bool {
+	if strings.HasPrefix(repository, "@") || strings.HasPrefix(repository, "alias:") {
+		return true
+	}
+	u, err := url.Parse(repository)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+func isLocked(lock Lock, dep LockedDependency) bool {
+	for _, locked := range lock.Dependencies {
+		if locked.Service == dep.Service && locked.Chart == dep.Chart && locked.Repository == dep.Repository && locked.Constraint == dep.Constraint {
+			return true
+		}
+	}
+	return false
+}
+
+// repoIndex downloads the index.yaml of a repository as it is written in a dependency.
+func (b *Boondoggle) repoIndex(repository string) (*repo.IndexFile, error) {
+	entry := repo.Entry{Name: repository, URL: repository}
+	name := ""
+	if strings.HasPrefix(repository, "@") {
+		name = strings.TrimPrefix(repository, "@")
+	} else if strings.HasPrefix(repository, "alias:") {
+		name = strings.TrimPrefix(repository, "alias:")
+	}
+	if name != "" {
+		found := false
+		for _, helmRepo := range b.HelmRepos {
+			if helmRepo.Name == name {
+				helmRepo, err := b.resolveRepo(helmRepo)
+				if err != nil {
+					return nil, err
+				}
+				entry = repo.Entry{Name: name, URL: helmRepo.URL, Username: helmRepo.Username, Password: helmRepo.Password}
+				found = true
+			}
+		}
+		// Prompted credentials are not in boondoggle.yml, use the ones helm has for the repo.
+		if !found || entry.Username == "" {
+			existing, err := b.existingHelmRepos()
+			if err == nil && existing[name] != nil {
+				entry = *existing[name]
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("helm repo %s is not in helm-repos or added to helm", name)
+		}
+	}
+	// The helm binary keeps basic auth in the url.
+	if u, err := url.Parse(entry.URL); err == nil && u.User != nil {
+		entry.Username = u.User.Username()
+		entry.Password, _ = u.User.Password()
+		u.User = nil
+		entry.URL = u.String()
+	}
+
+	settings := b.helmSettings("")
+	chartRepo, err := repo.NewChartRepository(&entry, getter.All(settings))
+	if err != nil {
+		return nil, err
+	}
+	cacheDir, err := ioutil.TempDir("", "boondoggle-index")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(cacheDir)
+	chartRepo.CachePath = cacheDir
+	indexPath, err := chartRepo.DownloadIndexFile()
+	if err != nil {
+		return nil, fmt.Errorf("error downloading the index of %s: %s", repository, err)
+	}
+	return repo.LoadIndexFile(indexPath)
+}
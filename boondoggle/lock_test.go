@@ -0,0 +1,136 @@
+package boondoggle
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const lockConfig = `services:
+  - name: service1
+    chart: service1-chart
+    states:
+      - state-name: default
+        repository: "@my-private-repo"
+        version: ~1
+      - state-name: stable
+        repository: "@my-private-repo"
+        version: 1.0.0
+      - state-name: local
+        repository: localdev
+        version: x
+  - name: service2
+    chart: service2-chart
+    states:
+      - state-name: default
+        repository: file://../service2-chart
+        version: x
+      - state-name: oci
+        repository: oci://registry.example.com/charts
+        version: 0.3.0
+`
+
+func chartIndex(versions ...string) string {
+	index := "apiVersion: v1\nentries:\n  service1-chart:\n"
+	for _, version := range versions {
+		index += fmt.Sprintf("    - name: service1-chart\n      version: %s\n      urls:\n        - service1-chart-%s.tgz\n", version, version)
+	}
+	return index
+}
+
+func TestResolveLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(dir, "repositories.yaml"))
+	defer os.Unsetenv("HELM_REPOSITORY_CONFIG")
+
+	index := chartIndex("1.0.0", "1.4.2", "2.0.0")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(index))
+	}))
+	defer server.Close()
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(lockConfig)); err != nil {
+		t.Fatal(err)
+	}
+	config, err := UnmarshalConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newFakeBoondoggle()
+	b.HelmRepos = []HelmRepo{{Name: "my-private-repo", URL: server.URL}}
+
+	lock, err := b.ResolveLock(config, Lock{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Dependencies) != 4 || lock.Dependencies[0].Version != "1.4.2" || lock.Dependencies[1].Version != "1.0.0" {
+		t.Fatalf("Expected ~1 to resolve to 1.4.2 and 1.0.0 to itself, got %+v", lock.Dependencies)
+	}
+	if lock.Dependencies[2].Version != "x" || lock.Dependencies[3].Version != "0.3.0" {
+		t.Errorf("Expected the file:// and oci:// ranges to be locked as they are, got %+v", lock.Dependencies[2:])
+	}
+
+	// A new version is only used with update.
+	index = chartIndex("1.0.0", "1.4.2", "1.5.0", "2.0.0")
+	if err := WriteLock(dir, lock); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := LoadLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err = b.ResolveLock(config, previous, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Dependencies[0].Version != "1.4.2" {
+		t.Error("Expected the locked version to be kept, got:", lock.Dependencies[0].Version)
+	}
+	lock, err = b.ResolveLock(config, previous, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Dependencies[0].Version != "1.5.0" {
+		t.Error("Expected update to resolve the version again, got:", lock.Dependencies[0].Version)
+	}
+
+	// BuildRequirements uses the lock, and --state-v-override still wins.
+	b.Lock = lock
+	b.Services = []Service{{Name: "service1", Chart: "service1-chart", Repository: "@my-private-repo", Version: "~1"}}
+	r := BuildRequirements(b, []string{})
+	if r.Dependencies[0].Version != "1.5.0" {
+		t.Error("Expected BuildRequirements to use the locked version, got:", r.Dependencies[0].Version)
+	}
+	r = BuildRequirements(b, []string{"service1=2.0.0"})
+	if r.Dependencies[0].Version != "2.0.0" {
+		t.Error("Expected --state-v-override to win over the lock, got:", r.Dependencies[0].Version)
+	}
+
+	var logged bytes.Buffer
+	b.L = log.New(&logged, "", 0)
+	b.Services = []Service{{Name: "service1", State: "next", Chart: "service1-chart", Repository: "@my-private-repo", Version: "~3"}}
+	r = BuildRequirements(b, []string{})
+	if r.Dependencies[0].Version != "~3" || !strings.Contains(logged.String(), "State next of service service1 is not in boondoggle.lock") {
+		t.Error("Expected the version range and a warning for a state missing from the lock, got:", r.Dependencies[0].Version, logged.String())
+	}
+
+	index = chartIndex("2.0.0")
+	if _, err := b.ResolveLock(config, Lock{}, false); err == nil || !strings.Contains(err.Error(), `no version of service1-chart in @my-private-repo matches "~1"`) {
+		t.Error("Expected an error for a range without a matching version, got:", err)
+	}
+}
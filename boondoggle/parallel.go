@@ -0,0 +1,179 @@
+package boondoggle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// buildResult is the outcome of the local build pipeline of one service.
+type buildResult struct {
+	Service  string
+	Status   string
+	Duration time.Duration
+}
+
+// DoLocalBuilds runs the preDeploySteps and the container-build of the services with the state set to "localdev".
+// With parallel greater than 1, the pipelines of up to that many services run at the same time. The steps of a
+// single service still run in order, and the first failure cancels the other pipelines. Otherwise the preDeploySteps
+// of every service run first, then the container-builds, and the first failure stops them.
+// In both cases the output is prefixed with the service name, and a summary of each service is printed at the end.
+func (b *Boondoggle) DoLocalBuilds(parallel int) error {
+	// Only the localdev services with something to build get a pipeline.
+	var services []Service
+	for _, service := range b.Services {
+		if service.Repository == "localdev" && (len(service.PreDeploySteps) > 0 || len(service.ContainerBuild) > 0) {
+			services = append(services, service)
+		}
+	}
+	if len(services) == 0 {
+		return nil
+	}
+	if parallel <= 1 {
+		return b.localBuildsInOrder(services)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+	var outMu sync.Mutex
+	sem := make(chan struct{}, parallel)
+	results := make([]buildResult, len(services))
+
+	for key, service := range services {
+		wg.Add(1)
+		go func(key int, service Service) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[key] = buildResult{Service: service.Name, Status: "ok"}
+			if ctx.Err() != nil {
+				results[key].Status = "cancelled"
+				return
+			}
+			start := time.Now()
+			stdout := newPrefixWriter(os.Stdout, service.Name, &outMu)
+			stderr := newPrefixWriter(os.Stderr, service.Name, &outMu)
+			err := b.runSteps(ctx, service, "preDeploySteps", service.PreDeploySteps, stdout, stderr)
+			if err == nil {
+				err = b.buildContainer(ctx, service, stdout, stderr)
+			}
+			stdout.Flush()
+			stderr.Flush()
+			results[key].Duration = time.Since(start).Round(time.Millisecond)
+			if err != nil && ctx.Err() != nil {
+				results[key].Status = "cancelled"
+			} else if err != nil {
+				results[key].Status = "failed"
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(key, service)
+	}
+	wg.Wait()
+
+	b.L.Print(buildSummary(results))
+	return firstErr
+}
+
+// localBuildsInOrder runs the preDeploySteps of the services, then their container-build, one at a time.
+func (b *Boondoggle) localBuildsInOrder(services []Service) error {
+	var firstErr error
+	var outMu sync.Mutex
+	results := make([]buildResult, len(services))
+	for key, service := range services {
+		results[key] = buildResult{Service: service.Name, Status: "ok"}
+	}
+	for _, kind := range []string{"preDeploySteps", "container-build"} {
+		for key, service := range services {
+			if firstErr != nil {
+				if results[key].Status == "ok" {
+					results[key].Status = "cancelled"
+				}
+				continue
+			}
+			start := time.Now()
+			stdout := newPrefixWriter(os.Stdout, service.Name, &outMu)
+			stderr := newPrefixWriter(os.Stderr, service.Name, &outMu)
+			var err error
+			if kind == "preDeploySteps" {
+				err = b.runSteps(context.Background(), service, kind, service.PreDeploySteps, stdout, stderr)
+			} else {
+				err = b.buildContainer(context.Background(), service, stdout, stderr)
+			}
+			stdout.Flush()
+			stderr.Flush()
+			results[key].Duration += time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				results[key].Status = "failed"
+				firstErr = err
+			}
+		}
+	}
+
+	b.L.Print(buildSummary(results))
+	return firstErr
+}
+
+// buildSummary formats the results of DoLocalBuilds as a table.
+func buildSummary(results []buildResult) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tRESULT\tDURATION")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Service, result.Status, result.Duration)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// prefixWriter writes complete lines to an io.Writer, each line prefixed with the name of a service.
+// Writers that share a mutex do not interleave their lines.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, name string, mu *sync.Mutex) *prefixWriter {
+	return &prefixWriter{w: w, prefix: []byte("[" + name + "] "), mu: mu}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// Flush writes the last line if it did not end with a newline.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(append(append([]byte{}, p.prefix...), line...))
+}
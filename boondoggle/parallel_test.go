@@ -0,0 +1,66 @@
+package boondoggle
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDoLocalBuildsParallel(t *testing.T) {
+	b, runner := newFakeBoondoggle(FakeResponse{Prefix: "make broken", ExitCode: 2})
+	var logged bytes.Buffer
+	b.L = log.New(&logged, "", 0)
+	b.Services = []Service{
+		{Name: "service1", Repository: "localdev", PreDeploySteps: []Step{{Cmd: "make", Args: []string{"build"}}}, ContainerBuild: []string{"build", "-t", "service1", "."}},
+		{Name: "service2", Repository: "localdev", PreDeploySteps: []Step{{Cmd: "make", Args: []string{"broken"}}}},
+		{Name: "service3", Repository: "@my-private-repo", ContainerBuild: []string{"build", "-t", "service3", "."}},
+	}
+	err := b.DoLocalBuilds(2)
+	if err == nil || !strings.Contains(err.Error(), "preDeploySteps[0] of service service2 exited with code 2") {
+		t.Error("Expected the error of service2, got:", err)
+	}
+	for _, line := range runner.CommandLines() {
+		if line == "docker build -t service3 ." {
+			t.Error("Expected no pipeline for a service that is not localdev")
+		}
+	}
+	if !strings.Contains(logged.String(), "SERVICE") || !strings.Contains(logged.String(), "service2  failed") {
+		t.Error("Expected a summary table, got:", logged.String())
+	}
+}
+
+func TestDoLocalBuildsInOrder(t *testing.T) {
+	b, runner := newFakeBoondoggle(FakeResponse{Prefix: "docker build -t service2", ExitCode: 1})
+	var logged bytes.Buffer
+	b.L = log.New(&logged, "", 0)
+	b.Services = []Service{
+		{Name: "service1", Repository: "localdev", PreDeploySteps: []Step{{Cmd: "make", Args: []string{"build"}}}, ContainerBuild: []string{"build", "-t", "service1", "."}},
+		{Name: "service2", Repository: "localdev", PreDeploySteps: []Step{{Cmd: "npm", Args: []string{"install"}}}, ContainerBuild: []string{"build", "-t", "service2", "."}},
+		{Name: "service3", Repository: "localdev", ContainerBuild: []string{"build", "-t", "service3", "."}},
+	}
+	err := b.DoLocalBuilds(1)
+	if err == nil || !strings.Contains(err.Error(), "container-build of service service2 exited with code 1") {
+		t.Error("Expected the error of service2, got:", err)
+	}
+	// The preDeploySteps of every service run before the container-builds, and the first failure stops them.
+	expectCommandLines(t, "DoLocalBuilds in order", runner, []string{"make build", "npm install", "docker build -t service1 .", "docker build -t service2 ."})
+	for _, row := range []string{"SERVICE", "service1  ok", "service2  failed", "service3  cancelled"} {
+		if !strings.Contains(logged.String(), row) {
+			t.Errorf("Expected %q in the summary table, got:\n%s", row, logged.String())
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := newPrefixWriter(&out, "service1", &sync.Mutex{})
+	w.Write([]byte("first line\nsecond "))
+	w.Write([]byte("line\nunfinished"))
+	w.Flush()
+	expected := "[service1] first line\n[service1] second line\n[service1] unfinished\n"
+	if out.String() != expected {
+		t.Error("Expected:", expected, "Got:", out.String())
+	}
+}
@@ -0,0 +1,78 @@
+package boondoggle
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	sshterminal "golang.org/x/crypto/ssh/terminal"
+)
+
+// Prompt is a value Boondoggle asks the user for, because it is not set in boondoggle.yml.
+type Prompt struct {
+	// Message is shown to the user.
+	Message string
+	// Key is the key in boondoggle.yml that sets the value, eg. "docker_password".
+	Key string
+	// Env are the environment variables the value of Key refers to, if any.
+	Env []string
+	// Secret values are not echoed.
+	Secret bool
+}
+
+// Prompter asks the user for the values that are missing from boondoggle.yml.
+type Prompter interface {
+	Prompt(p Prompt) (string, error)
+}
+
+// TerminalPrompter is the Prompter that reads the values from the terminal.
+type TerminalPrompter struct{}
+
+// Prompt implements Prompter.
+func (TerminalPrompter) Prompt(p Prompt) (string, error) {
+	fmt.Println(p.Message)
+	if p.Secret {
+		value, err := sshterminal.ReadPassword(int(os.Stdin.Fd()))
+		return string(value), err
+	}
+	var value string
+	_, err := fmt.Scanln(&value)
+	return value, err
+}
+
+// MissingValueError is returned by a NonInteractivePrompter for each value it is asked for.
+type MissingValueError struct {
+	Prompt Prompt
+}
+
+func (e MissingValueError) Error() string {
+	if len(e.Prompt.Env) > 0 {
+		return fmt.Sprintf("%s is not set: boondoggle.yml uses the environment variable %s, which is empty, and boondoggle is running non-interactively", e.Prompt.Key, strings.Join(e.Prompt.Env, ", "))
+	}
+	return fmt.Sprintf("%s is not set in boondoggle.yml and boondoggle is running non-interactively", e.Prompt.Key)
+}
+
+// NonInteractivePrompter is the Prompter used when there is no user to ask, eg. in CI. It never reads anything.
+type NonInteractivePrompter struct{}
+
+// Prompt implements Prompter.
+func (NonInteractivePrompter) Prompt(p Prompt) (string, error) {
+	return "", MissingValueError{Prompt: p}
+}
+
+// IsInteractive returns whether the standard input is a terminal a user can answer prompts in.
+func IsInteractive() bool {
+	return sshterminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// envVarRefs returns the environment variables a value from boondoggle.yml refers to.
+func envVarRefs(s string) []string {
+	var refs []string
+	os.Expand(s, func(name string) string {
+		if name != "$" {
+			refs = append(refs, name)
+		}
+		return ""
+	})
+	return refs
+}
@@ -0,0 +1,96 @@
+package boondoggle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StateDir is the directory, next to boondoggle.yml, where boondoggle keeps its own files.
+const StateDir = ".boondoggle"
+
+// ReleaseState is what "boondoggle up" was last run with for a release, so it can be run again with --resume.
+type ReleaseState struct {
+	Release               string   `yaml:"release"`
+	Namespace             string   `yaml:"namespace,omitempty"`
+	Environment           string   `yaml:"environment,omitempty"`
+	Profile               string   `yaml:"profile,omitempty"`
+	SetStateAll           string   `yaml:"set-state-all,omitempty"`
+	ServiceStates         []string `yaml:"service-states,omitempty"`
+	StateVersionOverrides []string `yaml:"state-version-overrides,omitempty"`
+	// ExtraEnv are the environment variables boondoggle.yml used, except the ones of credentials.
+	ExtraEnv map[string]string `yaml:"extra-env,omitempty"`
+	// Flags are the other flags that were given, by name.
+	Flags map[string]string `yaml:"flags,omitempty"`
+}
+
+func releaseStatePath(dir string, release string) string {
+	return filepath.Join(dir, StateDir, "releases", release+".yml")
+}
+
+func lastReleasePath(dir string) string {
+	return filepath.Join(dir, StateDir, "last-release")
+}
+
+// SaveReleaseState writes the state of a release under the .boondoggle directory in dir,
+// and records the release as the last one used.
+func SaveReleaseState(dir string, state ReleaseState) error {
+	if state.Release == "" || strings.ContainsAny(state.Release, `/\`) {
+		return fmt.Errorf("can not save the state of release %q", state.Release)
+	}
+	path := releaseStatePath(dir, state.Release)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("error saving the state of release %s: %s", state.Release, err)
+	}
+	out, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error saving the state of release %s: %s", state.Release, err)
+	}
+	// The state can contain values from extra env, keep it private.
+	err = ioutil.WriteFile(path, out, 0600)
+	if err != nil {
+		return fmt.Errorf("error saving the state of release %s: %s", state.Release, err)
+	}
+	err = ioutil.WriteFile(lastReleasePath(dir), []byte(state.Release+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("error saving the last release: %s", err)
+	}
+	return nil
+}
+
+// ReleaseStateExists tells if the state of release was saved in dir.
+func ReleaseStateExists(dir string, release string) bool {
+	_, err := os.Stat(releaseStatePath(dir, release))
+	return err == nil
+}
+
+// LoadReleaseState reads the state of a release saved by SaveReleaseState.
+// If release is empty, the state of the last release saved in dir is read.
+func LoadReleaseState(dir string, release string) (ReleaseState, error) {
+	var state ReleaseState
+	if release == "" {
+		last, err := ioutil.ReadFile(lastReleasePath(dir))
+		if os.IsNotExist(err) {
+			return state, fmt.Errorf("there is no release to resume, run boondoggle up with --release first")
+		} else if err != nil {
+			return state, fmt.Errorf("error reading the last release: %s", err)
+		}
+		release = strings.TrimSpace(string(last))
+	}
+	stateBytes, err := ioutil.ReadFile(releaseStatePath(dir, release))
+	if os.IsNotExist(err) {
+		return state, fmt.Errorf("there is no saved state for release %s, run boondoggle up without --resume first", release)
+	} else if err != nil {
+		return state, fmt.Errorf("error reading the state of release %s: %s", release, err)
+	}
+	err = yaml.Unmarshal(stateBytes, &state)
+	if err != nil {
+		return state, fmt.Errorf("error reading the state of release %s: %s", release, err)
+	}
+	return state, nil
+}
@@ -0,0 +1,57 @@
+package boondoggle
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReleaseState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := LoadReleaseState(dir, ""); err == nil {
+		t.Error("Expected an error when no release was saved")
+	}
+
+	mine := ReleaseState{
+		Release:               "me",
+		Namespace:             "me",
+		Environment:           "dev",
+		ServiceStates:         []string{"api=local", "web=local"},
+		StateVersionOverrides: []string{"worker=1.2.3"},
+		Flags:                 map[string]string{"helm-secrets": "true"},
+	}
+	theirs := ReleaseState{Release: "them", Profile: "frontend-dev"}
+	for _, state := range []ReleaseState{mine, theirs} {
+		if err := SaveReleaseState(dir, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !ReleaseStateExists(dir, "me") || ReleaseStateExists(dir, "nobody") {
+		t.Error("Expected only the saved releases to exist")
+	}
+	loaded, err := LoadReleaseState(dir, "me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, mine) {
+		t.Errorf("Expected %+v, got %+v", mine, loaded)
+	}
+	last, err := LoadReleaseState(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(last, theirs) {
+		t.Errorf("Expected the last release %+v, got %+v", theirs, last)
+	}
+
+	if err := SaveReleaseState(dir, ReleaseState{Release: "../escape"}); err == nil {
+		t.Error("Expected an error for a release name with a path separator")
+	}
+}
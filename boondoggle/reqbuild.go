@@ -1,12 +1,15 @@
 package boondoggle
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // Maintainer describes a Chart maintainer.
@@ -32,7 +35,7 @@ type Dependency struct {
 	Condition    string        `yaml:"condition,omitempty"`
 	Tags         []string      `yaml:"tags,omitempty"`
 	Enabled      bool          `yaml:"enabled,omitempty"`
-	Importvalues []interface{} `yaml:"importvalues,omitempty"`
+	Importvalues []interface{} `yaml:"import-values,omitempty"`
 	Alias        string        `yaml:"alias,omitempty"`
 }
 
@@ -58,6 +61,7 @@ type Chart struct {
 }
 
 //BuildRequirements converts a Boondoggle into a Helm Requirements struct.
+//Versions locked in b.Lock are used unless they are overridden with svo. A state missing from b.Lock is logged.
 func BuildRequirements(b Boondoggle, svo []string) Requirements {
 	var r Requirements
 	var repoLocation string
@@ -70,6 +74,13 @@ func BuildRequirements(b Boondoggle, svo []string) Requirements {
 		}
 
 		version := getVersionFlag(service, svo)
+		if version == service.Version && service.Repository != "localdev" && len(b.Lock.Dependencies) > 0 {
+			dep := LockedDependency{Service: service.Name, Chart: service.Chart, Repository: service.Repository, Constraint: version}
+			if !isLocked(b.Lock, dep) {
+				b.L.Print(Format(Yellow, fmt.Sprintf("State %s of service %s is not in %s, using the version range %s. Run boondoggle lock to add it.", service.State, service.Name, LockFileName, version)))
+			}
+			version = b.Lock.Version(service, version)
+		}
 
 		var dependency = Dependency{
 			Name:         service.Chart,
@@ -88,10 +99,12 @@ func BuildRequirements(b Boondoggle, svo []string) Requirements {
 }
 
 // WriteRequirements writes the dependencies to eithe chart.yaml or requirements.yaml depending on the version of helm you are running
+// In Chart.yaml only the dependencies are replaced. The rest of the file, comments included, is kept as it is.
 func WriteRequirements(r Requirements, b Boondoggle) error {
 	// read the chart.yaml file
 	chart := Chart{}
-	chartBytes, err := ioutil.ReadFile(b.Umbrella.Path + "/Chart.yaml")
+	chartPath := filepath.Join(b.Umbrella.Path, "Chart.yaml")
+	chartBytes, err := ioutil.ReadFile(chartPath)
 	if err != nil {
 		return err
 	}
@@ -101,17 +114,11 @@ func WriteRequirements(r Requirements, b Boondoggle) error {
 	}
 	// determine if chart is helm2 or helm3
 	if chart.APIVersion == "v2" {
-		chart.Dependencies = r.Dependencies
-		out, err := yaml.Marshal(chart)
-		if err != nil {
-			return err
-		}
-		path := fmt.Sprintf("%s/Chart.yaml", b.Umbrella.Path)
-		err = ioutil.WriteFile(path, out, 0644)
+		out, err := replaceDependencies(chartBytes, r)
 		if err != nil {
-			return err
+			return fmt.Errorf("error updating the dependencies in %s: %s", chartPath, err)
 		}
-		return nil
+		return ioutil.WriteFile(chartPath, out, 0644)
 	}
 
 	if chart.APIVersion == "v1" {
@@ -119,7 +126,7 @@ func WriteRequirements(r Requirements, b Boondoggle) error {
 		if err != nil {
 			return err
 		}
-		path := fmt.Sprintf("%s/requirements.yaml", b.Umbrella.Path)
+		path := filepath.Join(b.Umbrella.Path, "requirements.yaml")
 		err = ioutil.WriteFile(path, out, 0644)
 		if err != nil {
 			return err
@@ -131,6 +138,214 @@ func WriteRequirements(r Requirements, b Boondoggle) error {
 	return fmt.Errorf("invalid chart APIVersion specified")
 }
 
+// replaceDependencies replaces the lines of the top level dependencies key of a Chart.yaml with the dependencies in r.
+// If there is no dependencies key, it is added at the end. The comment of the dependencies line and the line endings
+// of the file are kept. A flow style Chart.yaml, or one where the dependencies share
+// a line with another key, can not be updated by lines, so it is encoded again with the new dependencies.
+func replaceDependencies(chartBytes []byte, r Requirements) ([]byte, error) {
+	out, err := yaml.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	var root yamlv3.Node
+	err = yamlv3.Unmarshal(chartBytes, &root)
+	if err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("it is not a yaml map")
+	}
+	mapping := root.Content[0]
+	lines := strings.SplitAfter(string(chartBytes), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	newline := "\n"
+	if bytes.Contains(chartBytes, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+
+	if mapping.Style&yamlv3.FlowStyle != 0 {
+		return encodeDependencies(&root, out, newline)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != "dependencies" {
+			continue
+		}
+		if (i > 0 && lastLine(mapping.Content[i-1]) >= mapping.Content[i].Line) ||
+			(i+2 < len(mapping.Content) && mapping.Content[i+2].Line <= lastLine(mapping.Content[i+1])) {
+			return encodeDependencies(&root, out, newline)
+		}
+		// The comment of the dependencies line is on the key, or on the value when it is on the same line.
+		comment := mapping.Content[i].LineComment
+		if comment == "" && mapping.Content[i+1].Line == mapping.Content[i].Line {
+			comment = mapping.Content[i+1].LineComment
+		}
+		deps := string(out)
+		if comment != "" {
+			deps = strings.Replace(deps, "dependencies:", "dependencies: "+comment, 1)
+		}
+		// Line numbers start at 1. The block ends before the next top level key, without the comments and blank lines
+		// above that key.
+		start := mapping.Content[i].Line - 1
+		end := len(lines)
+		if i+2 < len(mapping.Content) {
+			end = mapping.Content[i+2].Line - 1
+		}
+		last := lastLine(mapping.Content[i+1])
+		for end-1 > last-1 && end-1 > start {
+			trimmed := strings.TrimSpace(lines[end-1])
+			if trimmed != "" && !strings.HasPrefix(lines[end-1], "#") {
+				break
+			}
+			end--
+		}
+		var result []string
+		result = append(result, lines[:start]...)
+		result = append(result, strings.ReplaceAll(deps, "\n", newline))
+		result = append(result, lines[end:]...)
+		return []byte(strings.Join(result, "")), nil
+	}
+
+	// There is no dependencies key, add it at the end.
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		lines[len(lines)-1] += newline
+	}
+	return []byte(strings.Join(lines, "") + strings.ReplaceAll(string(out), "\n", newline)), nil
+}
+
+// encodeDependencies sets the top level dependencies key of the Chart.yaml in root to the dependencies yaml in out,
+// and encodes it in block style, with the given line ending.
+func encodeDependencies(root *yamlv3.Node, out []byte, newline string) ([]byte, error) {
+	var deps yamlv3.Node
+	err := yamlv3.Unmarshal(out, &deps)
+	if err != nil {
+		return nil, err
+	}
+	mapping := root.Content[0]
+	mapping.Style &^= yamlv3.FlowStyle
+	key, value := deps.Content[0].Content[0], deps.Content[0].Content[1]
+	replaced := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "dependencies" {
+			mapping.Content[i+1] = value
+			replaced = true
+		}
+	}
+	if !replaced {
+		mapping.Content = append(mapping.Content, key, value)
+	}
+	var buf bytes.Buffer
+	encoder := yamlv3.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(strings.ReplaceAll(buf.String(), "\n", newline)), nil
+}
+
+// lastLine is the last line of a yaml node and its children.
+func lastLine(node *yamlv3.Node) int {
+	last := node.Line
+	for _, child := range node.Content {
+		if line := lastLine(child); line > last {
+			last = line
+		}
+	}
+	return last
+}
+
+// GeneratedMarker is the file CopyUmbrella writes in a generated copy of the umbrella chart.
+// A directory without it is never removed.
+const GeneratedMarker = ".boondoggle-generated"
+
+/*
+CopyUmbrella copies the umbrella chart to dir, and points b at the copy, so the requirements can be written and the
+dependencies downloaded without changing the umbrella chart in the working tree. A previous copy in dir is replaced.
+Dependencies of the umbrella chart with a relative file:// repository must be reachable from dir as well.
+Symlinks are followed, and the files and directories they point to are copied.
+*/
+func CopyUmbrella(b *Boondoggle, dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dir, b.Umbrella.Path)
+	if err == nil && (rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))) {
+		return fmt.Errorf("can not copy the umbrella chart to %s, it contains the umbrella chart", dir)
+	}
+	if _, err := os.Stat(dir); err == nil {
+		if _, err := os.Stat(filepath.Join(dir, GeneratedMarker)); err != nil {
+			return fmt.Errorf("can not copy the umbrella chart to %s, it exists and was not generated by boondoggle", dir)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	err = copyDir(b.Umbrella.Path, dir, dir, map[string]bool{})
+	if err != nil {
+		return fmt.Errorf("error copying the umbrella chart to %s: %s", dir, err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, GeneratedMarker), []byte("Generated by boondoggle from "+b.Umbrella.Path+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	b.Umbrella.Path = dir
+	return nil
+}
+
+// copyDir copies the directory src to target, following symlinks. The .git and .boondoggle directories, and skip,
+// are not copied. visited holds the real paths of the directories being copied, to stop at symlink loops.
+func copyDir(src string, target string, skip string, visited map[string]bool) error {
+	real, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	if visited[real] {
+		return fmt.Errorf("%s is a symlink loop", src)
+	}
+	visited[real] = true
+	defer delete(visited, real)
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(src, entry.Name())
+		// os.Stat follows symlinks.
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir() && (entry.Name() == ".git" || entry.Name() == StateDir || path == skip):
+			continue
+		case info.IsDir():
+			err = copyDir(path, filepath.Join(target, entry.Name()), skip, visited)
+		case !info.Mode().IsRegular():
+			err = fmt.Errorf("%s is not a regular file", path)
+		default:
+			var content []byte
+			content, err = ioutil.ReadFile(path)
+			if err == nil {
+				err = ioutil.WriteFile(filepath.Join(target, entry.Name()), content, info.Mode().Perm())
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getVersionFlag(service Service, svo []string) string {
 	// for each of the --state-v-override flags...
 	for _, override := range svo {
@@ -0,0 +1,202 @@
+package boondoggle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+const umbrellaChart = `# The umbrella chart for my project.
+apiVersion: v2
+name: my-umbrella
+version: 0.1.0
+# Managed by boondoggle.
+dependencies:
+  - name: old-chart
+    version: ~1
+    repository: "@my-private-repo"
+    import-values:
+      - data
+
+# Kept as it is.
+x-custom:
+  owner: me
+appVersion: "1.0"
+`
+
+const umbrellaChartExpected = `# The umbrella chart for my project.
+apiVersion: v2
+name: my-umbrella
+version: 0.1.0
+# Managed by boondoggle.
+dependencies:
+- name: service1-chart
+  version: ~2
+  repository: '@my-private-repo'
+  import-values:
+  - data
+
+# Kept as it is.
+x-custom:
+  owner: me
+appVersion: "1.0"
+`
+
+var umbrellaRequirements = Requirements{Dependencies: []Dependency{
+	{Name: "service1-chart", Version: "~2", Repository: "@my-private-repo", Importvalues: []interface{}{"data"}},
+}}
+
+func TestWriteRequirements(t *testing.T) {
+	tests := []struct {
+		name     string
+		chart    string
+		expected string
+	}{
+		{"Test Replace", umbrellaChart, umbrellaChartExpected},
+		{"Test Last Key", "apiVersion: v2\nname: my-umbrella\ndependencies: []\n", "apiVersion: v2\nname: my-umbrella\n" + requirementsYaml(t)},
+		{"Test Missing", "apiVersion: v2\nname: my-umbrella", "apiVersion: v2\nname: my-umbrella\n" + requirementsYaml(t)},
+		{"Test Line Comment", "apiVersion: v2\nname: my-umbrella\ndependencies: # keep me\n  - name: old-chart\nversion: 0.1.0\n", "apiVersion: v2\nname: my-umbrella\n" + strings.Replace(requirementsYaml(t), "dependencies:", "dependencies: # keep me", 1) + "version: 0.1.0\n"},
+		{"Test CRLF", "apiVersion: v2\r\nname: my-umbrella\r\ndependencies: []\r\nversion: 0.1.0\r\n", "apiVersion: v2\r\nname: my-umbrella\r\n" + strings.ReplaceAll(requirementsYaml(t), "\n", "\r\n") + "version: 0.1.0\r\n"},
+		{"Test CRLF Missing", "apiVersion: v2\r\nname: my-umbrella", "apiVersion: v2\r\nname: my-umbrella\r\n" + strings.ReplaceAll(requirementsYaml(t), "\n", "\r\n")},
+		{"Test Flow Style", "{apiVersion: v2, name: my-umbrella, dependencies: []}\n", "apiVersion: v2\nname: my-umbrella\n" + flowChartDependencies},
+		{"Test Flow Style Not Last", "{apiVersion: v2, dependencies: [], name: my-umbrella}\n", "apiVersion: v2\n" + flowChartDependencies + "name: my-umbrella\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "boondoggle-umbrella")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			chartPath := filepath.Join(dir, "Chart.yaml")
+			if err := ioutil.WriteFile(chartPath, []byte(tt.chart), 0644); err != nil {
+				t.Fatal(err)
+			}
+			b := Boondoggle{Umbrella: Umbrella{Path: dir}}
+			if err := WriteRequirements(umbrellaRequirements, b); err != nil {
+				t.Fatal(err)
+			}
+			out, _ := ioutil.ReadFile(chartPath)
+			if string(out) != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, out)
+			}
+		})
+	}
+}
+
+// flowChartDependencies are the dependencies of a flow style Chart.yaml, which is encoded again.
+const flowChartDependencies = `dependencies:
+  - name: service1-chart
+    version: ~2
+    repository: '@my-private-repo'
+    import-values:
+      - data
+`
+
+func requirementsYaml(t *testing.T) string {
+	out, err := yaml.Marshal(umbrellaRequirements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestCopyUmbrella(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-umbrella")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	umbrella := filepath.Join(dir, "umbrella")
+	os.MkdirAll(filepath.Join(umbrella, "templates"), 0755)
+	os.MkdirAll(filepath.Join(umbrella, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(umbrella, "Chart.yaml"), []byte(umbrellaChart), 0644)
+	ioutil.WriteFile(filepath.Join(umbrella, "templates", "secret.yaml"), []byte("kind: Secret\n"), 0644)
+
+	b := Boondoggle{Umbrella: Umbrella{Path: umbrella}}
+	out := filepath.Join(dir, "build")
+	if err := CopyUmbrella(&b, out); err != nil {
+		t.Fatal(err)
+	}
+	if b.Umbrella.Path != out {
+		t.Error("Expected the umbrella path to be the copy, got:", b.Umbrella.Path)
+	}
+	if err := WriteRequirements(umbrellaRequirements, b); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := ioutil.ReadFile(filepath.Join(umbrella, "Chart.yaml"))
+	if string(original) != umbrellaChart {
+		t.Error("Expected the umbrella chart to be unchanged, got:", string(original))
+	}
+	if _, err := os.Stat(filepath.Join(out, "templates", "secret.yaml")); err != nil {
+		t.Error("Expected the templates to be copied:", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, ".git")); err == nil {
+		t.Error("Expected .git not to be copied")
+	}
+
+	// A generated copy is replaced, anything else is left alone.
+	b.Umbrella.Path = umbrella
+	if err := CopyUmbrella(&b, out); err != nil {
+		t.Error("Expected the generated copy to be replaced, got:", err)
+	}
+	b.Umbrella.Path = umbrella
+	if err := CopyUmbrella(&b, filepath.Join(umbrella, "templates")); err == nil {
+		t.Error("Expected an error copying to a directory that was not generated")
+	}
+	if err := CopyUmbrella(&b, dir); err == nil {
+		t.Error("Expected an error copying to a directory that contains the umbrella chart")
+	}
+
+	// The default build directory of up --isolated can be in the umbrella chart, it is not copied into itself.
+	build := filepath.Join(umbrella, StateDir, "build", "testrelease")
+	if err := CopyUmbrella(&b, build); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(build, StateDir)); err == nil {
+		t.Error("Expected the .boondoggle directory not to be copied")
+	}
+	if _, err := os.Stat(filepath.Join(build, "Chart.yaml")); err != nil {
+		t.Error("Expected Chart.yaml to be copied:", err)
+	}
+}
+
+func TestCopyUmbrellaSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-umbrella")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	shared := filepath.Join(dir, "shared")
+	os.MkdirAll(filepath.Join(shared, "charts"), 0755)
+	ioutil.WriteFile(filepath.Join(shared, "values.yaml"), []byte("replicas: 1\n"), 0644)
+	ioutil.WriteFile(filepath.Join(shared, "charts", "service1-chart-1.0.0.tgz"), []byte("chart"), 0644)
+	umbrella := filepath.Join(dir, "umbrella")
+	os.MkdirAll(umbrella, 0755)
+	ioutil.WriteFile(filepath.Join(umbrella, "Chart.yaml"), []byte(umbrellaChart), 0644)
+	os.Symlink(filepath.Join(shared, "values.yaml"), filepath.Join(umbrella, "values.yaml"))
+	os.Symlink(filepath.Join(shared, "charts"), filepath.Join(umbrella, "charts"))
+
+	b := Boondoggle{Umbrella: Umbrella{Path: umbrella}}
+	out := filepath.Join(dir, "build")
+	if err := CopyUmbrella(&b, out); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"values.yaml", filepath.Join("charts", "service1-chart-1.0.0.tgz")} {
+		info, err := os.Lstat(filepath.Join(out, file))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Errorf("Expected the target of the symlink %s to be copied, got: %v", file, err)
+		}
+	}
+
+	// A symlink loop is an error, not an endless copy.
+	os.Symlink(umbrella, filepath.Join(umbrella, "loop"))
+	b.Umbrella.Path = umbrella
+	if err := CopyUmbrella(&b, out); err == nil || !strings.Contains(err.Error(), "loop is a symlink loop") {
+		t.Error("Expected an error for the symlink loop, got:", err)
+	}
+}
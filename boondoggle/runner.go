@@ -0,0 +1,217 @@
+package boondoggle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Command is an external command (helm, kubectl, docker, git) to be run by a Runner.
+type Command struct {
+	Name   string
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Dir is the working directory of the command. Empty means the current directory.
+	Dir string
+	// Env is added to the environment of boondoggle, formatted "NAME=value".
+	Env []string
+	// Timeout stops the command after the given duration. 0 means no timeout.
+	Timeout time.Duration
+	// Context stops the command when it is done. nil means the command is never stopped.
+	Context context.Context
+}
+
+// NewCommand is a helper to build a Command from a name and its arguments.
+func NewCommand(name string, args ...string) Command {
+	return Command{Name: name, Args: args}
+}
+
+// String returns the command line, used for verbose output. Arguments are quoted like for a shell when needed,
+// so the command line can be copied into one.
+func (c Command) String() string {
+	words := []string{shellQuote(c.Name)}
+	for _, arg := range c.Args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// shellQuote puts a word in single quotes if a shell would not read it as a single word as it is.
+func shellQuote(word string) string {
+	if word != "" && strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-.,/:=@%+") == "" {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// ShellWords splits a command line into its arguments like a shell does: on spaces, except in single or
+// double quotes, and with backslash escapes. Nothing else is interpreted.
+func ShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			// In double quotes, a backslash only escapes the characters that are special there.
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && (quote == 0 || quote == '"'):
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %s", quote, s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %s", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Args are the arguments of a command in boondoggle.yml. They are either a list, or a string that is split with ShellWords.
+type Args []string
+
+// argsDecodeHook decodes the string form of Args.
+func argsDecodeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(Args{}) || from.Kind() != reflect.String {
+		return data, nil
+	}
+	return ShellWords(data.(string))
+}
+
+// Runner runs the external commands used by Boondoggle.
+type Runner interface {
+	// Run runs the command, streaming its output to the Stdout and Stderr of the Command.
+	Run(c Command) error
+	// Output runs the command and returns its standard output.
+	Output(c Command) ([]byte, error)
+	// CombinedOutput runs the command and returns its standard output and standard error.
+	CombinedOutput(c Command) ([]byte, error)
+}
+
+// ExitCode returns the exit code of a command from the error returned by a Runner.
+// It returns 0 for a nil error and -1 if the command could not be run at all.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// ExecRunner is the Runner that runs commands with os/exec.
+type ExecRunner struct{}
+
+// Run implements Runner.
+func (r ExecRunner) Run(c Command) error {
+	cmd, ctx, cancel := r.command(c)
+	defer cancel()
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	return timeoutError(ctx, c, cmd.Run())
+}
+
+// Output implements Runner.
+func (r ExecRunner) Output(c Command) ([]byte, error) {
+	cmd, ctx, cancel := r.command(c)
+	defer cancel()
+	out, err := cmd.Output()
+	return out, timeoutError(ctx, c, err)
+}
+
+// CombinedOutput implements Runner.
+func (r ExecRunner) CombinedOutput(c Command) ([]byte, error) {
+	cmd, ctx, cancel := r.command(c)
+	defer cancel()
+	out, err := cmd.CombinedOutput()
+	return out, timeoutError(ctx, c, err)
+}
+
+// command builds the exec.Cmd for a Command. The returned cancel func must always be called.
+func (ExecRunner) command(c Command) (*exec.Cmd, context.Context, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if c.Context != nil {
+		ctx = c.Context
+	}
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Stdin = c.Stdin
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	return cmd, ctx, cancel
+}
+
+// timeoutError replaces the error of a command that was killed by its timeout or its Context.
+func timeoutError(ctx context.Context, c Command, err error) error {
+	if err != nil && c.Context != nil && c.Context.Err() != nil {
+		return fmt.Errorf("cancelled")
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return TimeoutError{Timeout: c.Timeout}
+	}
+	return err
+}
+
+// TimeoutError is returned by a Runner for a command that was killed by its Timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
+}
+
+// exitError describes how the command what failed: its timeout, or its exit code.
+func exitError(what string, err error) error {
+	if _, ok := err.(TimeoutError); ok {
+		return fmt.Errorf("%s %s", what, err)
+	}
+	return fmt.Errorf("%s exited with code %d: %s", what, ExitCode(err), err)
+}
@@ -0,0 +1,280 @@
+package boondoggle
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The credential a secret reference is resolved for. docker-config: and netrc: references hold a username and a password.
+const (
+	SecretUsername = "username"
+	SecretPassword = "password"
+	SecretEmail    = "email"
+)
+
+// redactedSecret replaces secrets in the verbose output.
+const redactedSecret = "*****"
+
+/*
+SecretResolver resolves the references to secrets that the credentials in boondoggle.yml can be set to,
+instead of the secret itself:
+
+	file:///path/to/file              the content of the file, without the trailing newline
+	exec:pass show my-repo            the output of the command, without the trailing newline
+	docker-config:registry.example.com the credentials of the registry in ~/.docker/config.json, or its credential helper
+	netrc:charts.example.com          the login and password of the machine in ~/.netrc
+*/
+type SecretResolver interface {
+	// Resolve returns the secret ref refers to, for the credential field (SecretUsername, SecretPassword or SecretEmail).
+	// ok is false when ref is not a reference, and is used as it is.
+	Resolve(ref string, field string) (secret string, ok bool, err error)
+}
+
+// DefaultSecretResolver is the SecretResolver for file://, exec:, docker-config: and netrc: references.
+type DefaultSecretResolver struct {
+	// R runs the exec: commands and the docker credential helpers.
+	R Runner
+}
+
+// Resolve implements SecretResolver.
+func (d DefaultSecretResolver) Resolve(ref string, field string) (string, bool, error) {
+	var secret string
+	var err error
+	switch {
+	case strings.HasPrefix(ref, "file://"):
+		var content []byte
+		content, err = ioutil.ReadFile(strings.TrimPrefix(ref, "file://"))
+		secret = string(content)
+	case strings.HasPrefix(ref, "exec:"):
+		secret, err = d.exec(strings.TrimPrefix(ref, "exec:"))
+	case strings.HasPrefix(ref, "docker-config:"):
+		secret, err = d.dockerConfig(strings.TrimPrefix(ref, "docker-config:"), field)
+	case strings.HasPrefix(ref, "netrc:"):
+		secret, err = netrc(strings.TrimPrefix(ref, "netrc:"), field)
+	default:
+		return ref, false, nil
+	}
+	if err != nil {
+		return "", true, err
+	}
+	return strings.TrimRight(secret, "\r\n"), true, nil
+}
+
+// exec runs the command of an exec: reference. Its output is left out of the errors, as it may hold the secret.
+func (d DefaultSecretResolver) exec(command string) (string, error) {
+	args, err := ShellWords(command)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("exec: needs a command")
+	}
+	out, err := d.R.Output(NewCommand(args[0], args[1:]...))
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %s", args[0], err)
+	}
+	return string(out), nil
+}
+
+// dockerConfig reads the credentials of registry from the docker config.json, as written by "docker login".
+func (d DefaultSecretResolver) dockerConfig(registry string, field string) (string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Email    string `json:"email"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", fmt.Errorf("error reading %s: %s", filepath.Join(dir, "config.json"), err)
+	}
+
+	helper := config.CredsStore
+	if config.CredHelpers[registry] != "" {
+		helper = config.CredHelpers[registry]
+	}
+	for server, auth := range config.Auths {
+		if registryHost(server) != registryHost(registry) {
+			continue
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return "", fmt.Errorf("the auth of %s is not base64", server)
+			}
+			auth.Username, auth.Password = splitUserPassword(string(decoded))
+		}
+		switch {
+		case field == SecretEmail:
+			return auth.Email, nil
+		case auth.Username == "" && helper != "":
+			// docker login only writes an empty entry when the credentials are in a credential helper.
+		case field == SecretUsername:
+			return auth.Username, nil
+		default:
+			return auth.Password, nil
+		}
+	}
+	if helper == "" || field == SecretEmail {
+		return "", fmt.Errorf("%s is not in %s", registry, filepath.Join(dir, "config.json"))
+	}
+
+	cmd := NewCommand("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	out, err := d.R.Output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("docker-credential-%s has no credentials for %s: %s", helper, registry, err)
+	}
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", fmt.Errorf("error reading the output of docker-credential-%s", helper)
+	}
+	if field == SecretUsername {
+		return creds.Username, nil
+	}
+	return creds.Secret, nil
+}
+
+// registryHost is the host of a registry as written in the auths of the docker config.json, eg. "https://index.docker.io/v1/".
+// Docker Hub is "docker.io" in image names.
+func registryHost(registry string) string {
+	host := strings.SplitN(registry, "/", 2)[0]
+	if u, err := url.Parse(registry); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if host == "docker.io" || host == "registry-1.docker.io" {
+		return "index.docker.io"
+	}
+	return host
+}
+
+func splitUserPassword(s string) (string, string) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// netrc reads the login or password of machine from $NETRC or ~/.netrc, falling back to its default entry.
+func netrc(machine string, field string) (string, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanWords)
+	entries := map[string]map[string]string{}
+	var current map[string]string
+	for scanner.Scan() {
+		switch token := scanner.Text(); token {
+		case "machine":
+			if !scanner.Scan() {
+				break
+			}
+			current = map[string]string{}
+			if _, ok := entries[scanner.Text()]; !ok {
+				entries[scanner.Text()] = current
+			}
+		case "default":
+			current = map[string]string{}
+			if _, ok := entries[""]; !ok {
+				entries[""] = current
+			}
+		case "login", "password", "account":
+			if current != nil && scanner.Scan() {
+				current[token] = scanner.Text()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	entry, ok := entries[machine]
+	if !ok {
+		entry, ok = entries[""]
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is not in %s", machine, path)
+	}
+	if field == SecretUsername {
+		return entry["login"], nil
+	}
+	return entry["password"], nil
+}
+
+// secret resolves the value of a config key if it is a reference to a secret. Passwords and resolved secrets
+// are redacted from the verbose output.
+func (b *Boondoggle) secret(key string, field string, value string) (string, error) {
+	resolver := b.Secrets
+	if resolver == nil {
+		resolver = DefaultSecretResolver{R: b.R}
+	}
+	secret, ok, err := resolver.Resolve(value, field)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %s: %s", key, err)
+	}
+	if ok || field == SecretPassword {
+		b.redact = append(b.redact, secret)
+	}
+	return secret, nil
+}
+
+// resolveRepo resolves the credentials of a helm repo.
+func (b *Boondoggle) resolveRepo(repo HelmRepo) (HelmRepo, error) {
+	var err error
+	repo.Username, err = b.secret(helmRepoKey(repo.Name, "username"), SecretUsername, repo.Username)
+	if err != nil {
+		return repo, err
+	}
+	repo.Password, err = b.secret(helmRepoKey(repo.Name, "password"), SecretPassword, repo.Password)
+	return repo, err
+}
+
+// redacted replaces the secrets in s, for the verbose output.
+func (b *Boondoggle) redacted(s string) string {
+	for _, secret := range b.redact {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, redactedSecret)
+		s = strings.ReplaceAll(s, url.QueryEscape(secret), redactedSecret)
+	}
+	return s
+}
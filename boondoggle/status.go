@@ -0,0 +1,284 @@
+package boondoggle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// ReleaseStatus is the deployed state of a release compared with the services of Boondoggle.
+type ReleaseStatus struct {
+	Release   string          `json:"release"`
+	Namespace string          `json:"namespace"`
+	Revision  int             `json:"revision"`
+	Status    string          `json:"status"`
+	Services  []ServiceStatus `json:"services"`
+}
+
+// ServiceStatus is the deployed state of one service.
+type ServiceStatus struct {
+	Name string `json:"name"`
+	// State is the configured state of the service.
+	State string `json:"state"`
+	// Deployed is false if the service is not a dependency of the deployed umbrella chart.
+	Deployed   bool   `json:"deployed"`
+	Repository string `json:"repository,omitempty"`
+	Version    string `json:"version,omitempty"`
+	// Localdev is true if the release was deployed with the service in a localdev state.
+	Localdev  bool `json:"localdev"`
+	Pods      int  `json:"pods"`
+	ReadyPods int  `json:"readyPods"`
+}
+
+/*
+Status reads the deployed release and reports, for each service, the configured state, the deployed repository and
+version, whether it was deployed as localdev and how many of its pods are ready.
+With the cli helm backend the release is read from its helm secret with kubectl, so it requires helm 3 with the default
+secrets storage driver.
+Pods belong to a service when their app.kubernetes.io/name or app label is the chart or alias of the service.
+*/
+func (b *Boondoggle) Status(namespace string, releaseName string) (ReleaseStatus, error) {
+	if b.is2() {
+		return ReleaseStatus{}, fmt.Errorf("boondoggle status requires helmVersion 3")
+	}
+	rel, err := b.getRelease(namespace, releaseName)
+	if err != nil {
+		return ReleaseStatus{}, err
+	}
+	pods, err := b.getReleasePods(namespace, releaseName)
+	if err != nil {
+		return ReleaseStatus{}, err
+	}
+
+	status := ReleaseStatus{Release: releaseName, Namespace: namespace, Revision: rel.Version}
+	if rel.Info != nil {
+		status.Status = rel.Info.Status.String()
+	}
+	for _, service := range b.Services {
+		serviceStatus := ServiceStatus{Name: service.Name, State: service.State}
+		if dep := deployedDependency(rel.Chart, service); dep != nil {
+			serviceStatus.Deployed = true
+			serviceStatus.Repository = dep.Repository
+			serviceStatus.Version = dep.Version
+		}
+		// DoUpgrade sets boondoggleCacheBust for the services in localdev.
+		if values, ok := rel.Config[service.GetHelmDepName()].(map[string]interface{}); ok {
+			_, serviceStatus.Localdev = values["boondoggleCacheBust"]
+		}
+		for _, pod := range pods {
+			if pod.belongsTo(service) {
+				serviceStatus.Pods++
+				if pod.ready() {
+					serviceStatus.ReadyPods++
+				}
+			}
+		}
+		status.Services = append(status.Services, serviceStatus)
+	}
+	return status, nil
+}
+
+// Table formats the status as a table.
+func (s ReleaseStatus) Table() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Release %s in namespace %s, revision %d, %s\n\n", s.Release, s.Namespace, s.Revision, s.Status)
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tSTATE\tREPOSITORY\tVERSION\tLOCALDEV\tREADY")
+	for _, service := range s.Services {
+		repository, version := service.Repository, service.Version
+		if !service.Deployed {
+			repository, version = "not deployed", "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%d/%d\n", service.Name, service.State, repository, version, service.Localdev, service.ReadyPods, service.Pods)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// getRelease reads the deployed revision of a release.
+func (b *Boondoggle) getRelease(namespace string, releaseName string) (*release.Release, error) {
+	if b.useHelmSDK() {
+		cfg, err := b.helmActionConfig(b.helmSettings(namespace))
+		if err != nil {
+			return nil, err
+		}
+		rel, err := action.NewGet(cfg).Run(releaseName)
+		if err == driver.ErrReleaseNotFound {
+			return nil, releaseNotDeployedError{release: releaseName, namespace: namespace}
+		}
+		return rel, err
+	}
+
+	fullcommand := []string{"get", "secrets", "-l", "owner=helm,status=deployed,name=" + releaseName, "-o", "json"}
+	if namespace != "" {
+		fullcommand = append(fullcommand, "--namespace", namespace)
+	}
+	cmd := NewCommand("kubectl", fullcommand...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.Output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the release %s: %s", releaseName, err)
+	}
+	var secrets struct {
+		Items []struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Data map[string]string `json:"data"`
+		} `json:"items"`
+	}
+	err = json.Unmarshal(out, &secrets)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the release %s: %s", releaseName, err)
+	}
+
+	// There should only be one deployed revision. If there are more, use the latest one.
+	data, latest := "", -1
+	for _, secret := range secrets.Items {
+		version, _ := strconv.Atoi(secret.Metadata.Labels["version"])
+		if version > latest {
+			data, latest = secret.Data["release"], version
+		}
+	}
+	if latest < 0 {
+		return nil, releaseNotDeployedError{release: releaseName, namespace: namespace}
+	}
+	// The data of a secret is base64 encoded by kubernetes, on top of helm's own encoding.
+	encoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the release %s: %s", releaseName, err)
+	}
+	return decodeRelease(string(encoded))
+}
+
+// releaseNotDeployedError is returned by getRelease for a release without a deployed revision.
+type releaseNotDeployedError struct {
+	release   string
+	namespace string
+}
+
+func (e releaseNotDeployedError) Error() string {
+	return fmt.Sprintf("release %s is not deployed in namespace %s", e.release, e.namespace)
+}
+
+// decodeRelease decodes a release the way helm stores it: gzipped json, base64 encoded.
+func decodeRelease(data string) (*release.Release, error) {
+	releaseBytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the release: %s", err)
+	}
+	if bytes.HasPrefix(releaseBytes, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(releaseBytes))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding the release: %s", err)
+		}
+		defer r.Close()
+		releaseBytes, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding the release: %s", err)
+		}
+	}
+	var rel release.Release
+	err = json.Unmarshal(releaseBytes, &rel)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the release: %s", err)
+	}
+	return &rel, nil
+}
+
+// deployedDependency finds the service in the dependencies of the deployed umbrella chart.
+// The version is the resolved one from the lock, if there is one.
+func deployedDependency(umbrella *chart.Chart, service Service) *chart.Dependency {
+	if umbrella == nil || umbrella.Metadata == nil {
+		return nil
+	}
+	for _, dep := range umbrella.Metadata.Dependencies {
+		depName := dep.Alias
+		if depName == "" {
+			depName = dep.Name
+		}
+		if depName != service.GetHelmDepName() {
+			continue
+		}
+		deployed := *dep
+		if umbrella.Lock != nil {
+			for _, locked := range umbrella.Lock.Dependencies {
+				if locked.Name == dep.Name && locked.Repository == dep.Repository {
+					deployed.Version = locked.Version
+					break
+				}
+			}
+		}
+		return &deployed
+	}
+	return nil
+}
+
+// pod is the part of a kubernetes pod read by Status.
+type pod struct {
+	Metadata struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Status struct {
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// getReleasePods lists the pods of a release with kubectl.
+func (b *Boondoggle) getReleasePods(namespace string, releaseName string) ([]pod, error) {
+	fullcommand := []string{"get", "pods", "-l", "app.kubernetes.io/instance=" + releaseName, "-o", "json"}
+	if namespace != "" {
+		fullcommand = append(fullcommand, "--namespace", namespace)
+	}
+	cmd := NewCommand("kubectl", fullcommand...)
+	if b.Verbose {
+		b.L.Print(Format(Cyan, "Command: "+cmd.String()))
+	}
+	out, err := b.R.Output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the pods of release %s: %s", releaseName, err)
+	}
+	var pods struct {
+		Items []pod `json:"items"`
+	}
+	err = json.Unmarshal(out, &pods)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the pods of release %s: %s", releaseName, err)
+	}
+	return pods.Items, nil
+}
+
+func (p pod) belongsTo(service Service) bool {
+	for _, label := range []string{"app.kubernetes.io/name", "app"} {
+		value := p.Metadata.Labels[label]
+		if value != "" && (strings.EqualFold(value, service.Chart) || strings.EqualFold(value, service.GetHelmDepName())) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p pod) ready() bool {
+	for _, condition := range p.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
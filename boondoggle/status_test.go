@@ -0,0 +1,115 @@
+package boondoggle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// releaseSecret returns the kubectl output for the helm secret of rel.
+func releaseSecret(t *testing.T, rel release.Release) string {
+	releaseBytes, err := json.Marshal(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(releaseBytes)
+	w.Close()
+	helmEncoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+	secrets := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]string{"version": "3"}},
+				"data":     map[string]string{"release": base64.StdEncoding.EncodeToString([]byte(helmEncoded))},
+			},
+		},
+	}
+	out, err := json.Marshal(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestStatus(t *testing.T) {
+	rel := release.Release{
+		Name:    "testrelease",
+		Version: 3,
+		Info:    &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				Name: "my-umbrella",
+				Dependencies: []*chart.Dependency{
+					{Name: "service1-chart", Version: "~1", Repository: "https://example.com/repo"},
+					{Name: "service2-chart", Alias: "alias-service2", Version: "x", Repository: "file://../service2"},
+				},
+			},
+			Lock: &chart.Lock{
+				Dependencies: []*chart.Dependency{
+					{Name: "service1-chart", Version: "1.4.2", Repository: "https://example.com/repo"},
+					{Name: "service2-chart", Version: "0.1.0", Repository: "file://../service2"},
+				},
+			},
+		},
+		Config: map[string]interface{}{
+			"alias-service2": map[string]interface{}{"boondoggleCacheBust": "1600000000"},
+		},
+	}
+	pods := `{"items": [
+		{"metadata": {"labels": {"app.kubernetes.io/name": "service1-chart"}}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}},
+		{"metadata": {"labels": {"app.kubernetes.io/name": "service1-chart"}}, "status": {"conditions": [{"type": "Ready", "status": "False"}]}},
+		{"metadata": {"labels": {"app": "alias-service2"}}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}
+	]}`
+
+	b, runner := newFakeBoondoggle(
+		FakeResponse{Prefix: "kubectl get secrets", Out: releaseSecret(t, rel)},
+		FakeResponse{Prefix: "kubectl get pods", Out: pods},
+	)
+	b.HelmVersion = 3
+	b.Services = []Service{
+		{Name: "service1", State: "default", Chart: "service1-chart"},
+		{Name: "service2", State: "local", Chart: "service2-chart", Alias: "alias-service2"},
+		{Name: "service3", State: "default", Chart: "service3-chart"},
+	}
+	status, err := b.Status("mynamespace", "testrelease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCommandLines(t, "Status", runner, []string{
+		"kubectl get secrets -l owner=helm,status=deployed,name=testrelease -o json --namespace mynamespace",
+		"kubectl get pods -l app.kubernetes.io/instance=testrelease -o json --namespace mynamespace",
+	})
+
+	expected := []ServiceStatus{
+		{Name: "service1", State: "default", Deployed: true, Repository: "https://example.com/repo", Version: "1.4.2", Pods: 2, ReadyPods: 1},
+		{Name: "service2", State: "local", Deployed: true, Repository: "file://../service2", Version: "0.1.0", Localdev: true, Pods: 1, ReadyPods: 1},
+		{Name: "service3", State: "default"},
+	}
+	if status.Revision != 3 || status.Status != "deployed" || len(status.Services) != len(expected) {
+		t.Fatal("Unexpected status:", status)
+	}
+	for key, service := range status.Services {
+		if service != expected[key] {
+			t.Errorf("Expected %+v, got %+v", expected[key], service)
+		}
+	}
+	if !strings.Contains(status.Table(), "service3  default  not deployed") {
+		t.Error("Expected service3 to be shown as not deployed, got:\n", status.Table())
+	}
+}
+
+func TestStatusNotDeployed(t *testing.T) {
+	b, _ := newFakeBoondoggle(FakeResponse{Prefix: "kubectl get secrets", Out: `{"items": []}`})
+	b.HelmVersion = 3
+	_, err := b.Status("mynamespace", "testrelease")
+	if err == nil || !strings.Contains(err.Error(), "is not deployed") {
+		t.Error("Expected an error for a release that is not deployed, got:", err)
+	}
+}
@@ -0,0 +1,296 @@
+package boondoggle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ConfigError is a single problem with the boondoggle config or the flags given to boondoggle.
+type ConfigError struct {
+	// File is the config file with the problem, when boondoggle.yml includes other files.
+	File string
+	// Path is the location of the problem in boondoggle.yml, eg. services[1].states. Empty for flag problems.
+	Path string
+	// Line is the line number in boondoggle.yml, if it is known.
+	Line    int
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	message := e.Message
+	if e.Line > 0 {
+		message = fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s: %s", e.File, message)
+	}
+	return message
+}
+
+// ConfigErrors is every problem found while building a Boondoggle.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := []string{fmt.Sprintf("boondoggle config has %d problem(s):", len(e))}
+	for _, configError := range e {
+		lines = append(lines, "  "+configError.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// UnmarshalConfig unmarshals the config read by viper into a RawBoondoggle.
+// Keys that do not match a setting are recorded in RawBoondoggle.UnknownKeys.
+func UnmarshalConfig(v *viper.Viper) (RawBoondoggle, error) {
+	var config RawBoondoggle
+	var metadata mapstructure.Metadata
+	err := v.Unmarshal(&config, func(c *mapstructure.DecoderConfig) {
+		c.Metadata = &metadata
+		// The default hooks of viper, after the one for Args.
+		c.DecodeHook = mapstructure.ComposeDecodeHookFunc(
+			argsDecodeHook,
+			helmValueDecodeHook,
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		)
+	})
+	config.UnknownKeys = metadata.Unused
+	sort.Strings(config.UnknownKeys)
+	return config, err
+}
+
+// AddLines looks up the line number of each error in the given boondoggle.yml contents.
+func (e ConfigErrors) AddLines(configBytes []byte) ConfigErrors {
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(configBytes, &root); err != nil || len(root.Content) == 0 {
+		return e
+	}
+	for key, configError := range e {
+		if configError.Path != "" {
+			e[key].Line = findLine(root.Content[0], configError.Path)
+		}
+	}
+	return e
+}
+
+// findLine follows a path like services[1].states[0].state-name through a yaml node tree.
+// It returns the line of the deepest node it could find.
+func findLine(node *yamlv3.Node, path string) int {
+	line := node.Line
+	for _, segment := range strings.Split(strings.ReplaceAll(path, "[", ".["), ".") {
+		if segment == "" {
+			continue
+		}
+		found := false
+		if strings.HasPrefix(segment, "[") && node.Kind == yamlv3.SequenceNode {
+			index, err := strconv.Atoi(strings.Trim(segment, "[]"))
+			if err == nil && index < len(node.Content) {
+				node = node.Content[index]
+				line = node.Line
+				found = true
+			}
+		} else if node.Kind == yamlv3.MappingNode {
+			// viper lower-cases every key, so keys are compared without case.
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if strings.EqualFold(node.Content[i].Value, segment) {
+					line = node.Content[i].Line
+					node = node.Content[i+1]
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return line
+}
+
+// checkConfig finds the problems in a RawBoondoggle that do not depend on the chosen environment or states.
+func checkConfig(r RawBoondoggle) ConfigErrors {
+	var errs ConfigErrors
+	for _, key := range r.UnknownKeys {
+		errs = append(errs, ConfigError{Path: key, Message: fmt.Sprintf("unknown key %s", key)})
+	}
+
+	names := map[string]bool{}
+	depNames := map[string]bool{}
+	for key, rawService := range r.Services {
+		path := fmt.Sprintf("services[%d]", key)
+		if names[rawService.Name] {
+			errs = append(errs, ConfigError{Path: path + ".name", Message: fmt.Sprintf("duplicate service name %s", rawService.Name)})
+		}
+		names[rawService.Name] = true
+
+		depName := Service{Alias: rawService.Alias, Chart: rawService.Chart}.GetHelmDepName()
+		if depNames[depName] {
+			errs = append(errs, ConfigError{Path: path, Message: fmt.Sprintf("duplicate alias or chart name %s for service %s", depName, rawService.Name)})
+		}
+		depNames[depName] = true
+
+		hasDefault := false
+		for stateKey, rawState := range rawService.States {
+			if rawState.StateName == "default" {
+				hasDefault = true
+			}
+			for valueKey, value := range rawState.HelmValues {
+				valuePath := fmt.Sprintf("%s.states[%d].helm-values[%d]", path, stateKey, valueKey)
+				switch value.Type {
+				case "", HelmValueString, HelmValueRaw, HelmValueFile, HelmValueJSON:
+				default:
+					errs = append(errs, ConfigError{Path: valuePath + ".type", Message: fmt.Sprintf("unknown helm value type %s, expected string, raw, file or json", value.Type)})
+				}
+				if value.Type == HelmValueJSON && (r.HelmVersion == 0 || r.HelmVersion == 2) {
+					errs = append(errs, ConfigError{Path: valuePath + ".type", Message: "helm value type json needs helm 3.10 or later (--set-json), set helmVersion: 3"})
+				}
+				if value.Key == "" {
+					errs = append(errs, ConfigError{Path: valuePath, Message: fmt.Sprintf("a helm value of service %s has no key", rawService.Name)})
+				}
+			}
+		}
+		if !hasDefault {
+			errs = append(errs, ConfigError{Path: path + ".states", Message: fmt.Sprintf("service %s has no default state", rawService.Name)})
+		}
+	}
+
+	errs = append(errs, checkEnvironments(r)...)
+
+	for key, rawSecret := range r.PullSecrets {
+		path := fmt.Sprintf("pull-secrets[%d]", key)
+		if rawSecret.Name == "" {
+			errs = append(errs, ConfigError{Path: path, Message: "pull secret has no name"})
+		}
+		if rawSecret.Server == "" {
+			errs = append(errs, ConfigError{Path: path, Message: fmt.Sprintf("pull secret %s has no server", rawSecret.Name)})
+		}
+	}
+
+	profiles := make([]string, 0, len(r.Profiles))
+	for profile := range r.Profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	for _, profile := range profiles {
+		services := make([]string, 0, len(r.Profiles[profile]))
+		for name := range r.Profiles[profile] {
+			services = append(services, name)
+		}
+		sort.Strings(services)
+		for _, name := range services {
+			if name != ProfileEnvKey && rawServiceKeyFold(name, r) == -1 {
+				errs = append(errs, ConfigError{Path: "profiles." + profile + "." + name, Message: fmt.Sprintf("profile %s names unknown service %s", profile, name)})
+			}
+		}
+	}
+	return errs
+}
+
+// checkNameValueFlags finds the values of a flag that are not formatted "name=value".
+func checkNameValueFlags(flag string, values []string) ConfigErrors {
+	var errs ConfigErrors
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		splitValue := strings.SplitN(value, "=", 2)
+		if len(splitValue) != 2 || splitValue[0] == "" || splitValue[1] == "" {
+			errs = append(errs, ConfigError{Message: fmt.Sprintf("--%s %q is not formatted name=value", flag, value)})
+		}
+	}
+	return errs
+}
+
+// CheckStateVersionOverrides finds the --state-v-override flags that are malformed or name an unknown service.
+func (b *Boondoggle) CheckStateVersionOverrides(svo []string) error {
+	errs := checkNameValueFlags("state-v-override", svo)
+	for _, override := range svo {
+		name := strings.SplitN(override, "=", 2)[0]
+		if name != "" && strings.Contains(override, "=") && !b.hasService(name) {
+			errs = append(errs, ConfigError{Message: fmt.Sprintf("--state-v-override names unknown service %s", name)})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (b *Boondoggle) hasService(name string) bool {
+	for _, service := range b.Services {
+		if service.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLocalPaths finds the chosen localdev services whose chart is missing and can not be cloned.
+func (b *Boondoggle) checkLocalPaths(r RawBoondoggle) ConfigErrors {
+	var errs ConfigErrors
+	for _, service := range b.Services {
+		if service.Repository != "localdev" {
+			continue
+		}
+		path := fmt.Sprintf("services[%d].path", rawServiceKey(service.Name, r))
+		if service.Path == "" {
+			errs = append(errs, ConfigError{Path: path, Message: fmt.Sprintf("service %s is localdev but has no path", service.Name)})
+			continue
+		}
+		if _, err := os.Stat(service.Path); os.IsNotExist(err) {
+			// A missing checkout is cloned by "boondoggle up" when there is a gitrepo.
+			if service.Gitrepo == "" {
+				errs = append(errs, ConfigError{Path: path, Message: fmt.Sprintf("service %s is localdev but %s does not exist and there is no gitrepo to clone", service.Name, service.Path)})
+			}
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(service.Path, service.Chart)); os.IsNotExist(err) {
+			errs = append(errs, ConfigError{Path: path, Message: fmt.Sprintf("service %s is localdev but its chart %s does not exist", service.Name, filepath.Join(service.Path, service.Chart))})
+		}
+	}
+	return errs
+}
+
+func rawServiceKey(name string, r RawBoondoggle) int {
+	for key, rawService := range r.Services {
+		if rawService.Name == name {
+			return key
+		}
+	}
+	return -1
+}
+
+// rawServiceKeyFold is rawServiceKey for names that were lower-cased by viper.
+func rawServiceKeyFold(name string, r RawBoondoggle) int {
+	for key, rawService := range r.Services {
+		if strings.EqualFold(rawService.Name, name) {
+			return key
+		}
+	}
+	return -1
+}
+
+// checkHelmBackend finds settings that the chosen helm backend can not use.
+func (b *Boondoggle) checkHelmBackend() ConfigErrors {
+	switch b.HelmBackend {
+	case HelmBackendCLI:
+		return nil
+	case HelmBackendSDK:
+		var errs ConfigErrors
+		if b.is2() {
+			errs = append(errs, ConfigError{Path: "helmVersion", Message: "the sdk helm backend requires helmVersion 3"})
+		}
+		if len(b.Umbrella.AddtlHelmFlags) > 0 {
+			errs = append(errs, ConfigError{Path: "umbrella.environments", Message: "addtlHelmFlags can not be used with the sdk helm backend"})
+		}
+		return errs
+	}
+	return ConfigErrors{{Path: "helmBackend", Message: fmt.Sprintf("unknown helmBackend %s, use %s or %s", b.HelmBackend, HelmBackendCLI, HelmBackendSDK)}}
+}
@@ -0,0 +1,87 @@
+package boondoggle
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const invalidConfig = `helmVersion: 3
+bogus: true
+umbrella:
+  name: my-umbrella
+  path: /my-umbrella
+  environments:
+    - name: default
+      filez:
+        - "prod.yml"
+services:
+  - name: service1
+    chart: service1-chart
+    states:
+      - state-name: local
+        repository: localdev
+  - name: service1
+    chart: service1-chart
+    states:
+      - state-name: default
+        repository: "@my-private-repo"
+profiles:
+  mine:
+    service1: local
+    service3: local
+pull-secrets:
+  - name: ghcr
+`
+
+func TestNewBoondoggleErrors(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(invalidConfig)); err != nil {
+		t.Fatal(err)
+	}
+	config, err := UnmarshalConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewBoondoggle(config, "dev", "theirs", "", []string{"service1=local", "nope=local", "malformed"}, map[string]string{}, log.New(ioutil.Discard, "", 0), false, false)
+	configErrors, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatal("Expected ConfigErrors, got:", err)
+	}
+	configErrors = configErrors.AddLines([]byte(invalidConfig))
+
+	expected := []string{
+		"line 2: unknown key bogus",
+		"line 8: unknown key umbrella.environments[0].filez",
+		"line 16: duplicate service name service1",
+		"line 16: duplicate alias or chart name service1-chart for service service1",
+		"line 13: service service1 has no default state",
+		`--service-state "malformed" is not formatted name=value`,
+		"--service-state names unknown service nope",
+		"line 6: the environment dev was not found",
+		"line 11: service service1 is localdev but has no path",
+		"line 24: profile mine names unknown service service3",
+		"line 21: the profile theirs was not found",
+		"line 26: pull secret ghcr has no server",
+	}
+	for _, expectedError := range expected {
+		if !strings.Contains(configErrors.Error(), expectedError) {
+			t.Error("Expected to find:", expectedError, "\n", "Got:", configErrors.Error())
+		}
+	}
+}
+
+func TestCheckStateVersionOverrides(t *testing.T) {
+	b := Boondoggle{Services: []Service{{Name: "service1"}}}
+	if err := b.CheckStateVersionOverrides([]string{"", "service1=1.0.0"}); err != nil {
+		t.Error("Expected no error, got:", err)
+	}
+	err := b.CheckStateVersionOverrides([]string{"service1", "service2=1.0.0"})
+	if err == nil || len(err.(ConfigErrors)) != 2 {
+		t.Error("Expected 2 problems, got:", err)
+	}
+}
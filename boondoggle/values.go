@@ -0,0 +1,250 @@
+package boondoggle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// The types of a helm value, and the helm flag each one is passed with.
+const (
+	// HelmValueString is --set-string.
+	HelmValueString = "string"
+	// HelmValueRaw is --set, where helm types booleans, numbers and null.
+	HelmValueRaw = "raw"
+	// HelmValueFile is --set-file, the value is the path to a file holding the value.
+	HelmValueFile = "file"
+	// HelmValueJSON is --set-json, the value is a JSON document.
+	HelmValueJSON = "json"
+)
+
+// HelmValue is an entry of the helm-values of a service state. It is either a plain "key=value" string,
+// or a map with a key, a value and a type.
+type HelmValue struct {
+	Key   string `mapstructure:"key"`
+	Value string `mapstructure:"value"`
+	// Type is one of HelmValueString (the default of the map form), HelmValueRaw, HelmValueFile or HelmValueJSON.
+	// It is empty for the plain form, which is passed to --set-string as it is written.
+	Type string `mapstructure:"type"`
+}
+
+// helmValueDecodeHook decodes the plain form of a HelmValue, and the scalar values of the map form, which
+// viper would otherwise decode weakly, eg. true as "1". The map and list values of type json are encoded as JSON.
+// The values of type string and file must be yaml strings, as yaml has already changed the form of other scalars,
+// eg. 1.10 to 1.1.
+func helmValueDecodeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(HelmValue{}) {
+		return data, nil
+	}
+	switch from.Kind() {
+	case reflect.String:
+		parts := strings.SplitN(data.(string), "=", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("helm value %q has no '='", data)
+		}
+		return HelmValue{Key: parts[0], Value: parts[1]}, nil
+	case reflect.Map:
+		m := map[string]interface{}{"type": HelmValueString}
+		iter := reflect.ValueOf(data).MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+		}
+		switch value := m["value"].(type) {
+		case string, nil:
+		case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+			if m["type"] != HelmValueJSON {
+				return nil, fmt.Errorf("the value of helm value %v is a map or a list, which needs type json", m["key"])
+			}
+			encoded, err := json.Marshal(jsonValue(value))
+			if err != nil {
+				return nil, fmt.Errorf("error encoding the json value of %v: %s", m["key"], err)
+			}
+			m["value"] = string(encoded)
+		default:
+			if m["type"] == HelmValueString || m["type"] == HelmValueFile {
+				return nil, fmt.Errorf("the value %v of helm value %v is not a yaml string, quote it so it is passed as it is written", value, m["key"])
+			}
+			m["value"] = fmt.Sprint(value)
+		}
+		return m, nil
+	}
+	return data, nil
+}
+
+// jsonValue converts the map[interface{}]interface{} maps of a yaml value to map[string]interface{}, for json.Marshal.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = jsonValue(value)
+		}
+		return s
+	}
+	return v
+}
+
+// setArg returns the helm flag and its argument for the value, with the key prefixed by prefix.
+// The values of the map form are escaped, so commas are not read as separators by helm.
+func (v HelmValue) setArg(prefix string) (string, string) {
+	key := prefix + v.Key
+	escaped := strings.NewReplacer(`\`, `\\`, `,`, `\,`).Replace(v.Value)
+	switch v.Type {
+	case HelmValueRaw:
+		return "--set", key + "=" + escaped
+	case HelmValueFile:
+		return "--set-file", key + "=" + escaped
+	case HelmValueJSON:
+		return "--set-json", key + "=" + v.Value
+	case HelmValueString:
+		return "--set-string", key + "=" + escaped
+	}
+	return "--set-string", key + "=" + v.Value
+}
+
+// helmValues are the values passed to helm, for the helm SDK.
+type helmValues struct {
+	values.Options
+	// JSONValues are the --set-json values, that the options of the vendored helm do not have.
+	JSONValues []string
+	// Generated is the temporary values file of the values-files of the services, or of all the values with mergeValues.
+	Generated string
+}
+
+// add adds a helm value flag, as returned by setArg.
+func (v *helmValues) add(flag string, value string) {
+	switch flag {
+	case "--set":
+		v.Values = append(v.Values, value)
+	case "--set-string":
+		v.StringValues = append(v.StringValues, value)
+	case "--set-file":
+		v.FileValues = append(v.FileValues, value)
+	case "--set-json":
+		v.JSONValues = append(v.JSONValues, value)
+	}
+}
+
+// MergeValues merges the values like the helm CLI does: the values files, then the --set-json, --set,
+// --set-string and --set-file values.
+func (v helmValues) MergeValues(p getter.Providers) (map[string]interface{}, error) {
+	files := values.Options{ValueFiles: v.ValueFiles}
+	base, err := files.MergeValues(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range v.JSONValues {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("failed parsing --set-json data %s", value)
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(parts[1]), &parsed); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-json data %s: %s", value, err)
+		}
+		// The key is parsed by strvals like helm does, with its list indexes and escaped dots. The JSON is not
+		// parsed as a strvals value, which stops at commas: the reader returns it in place of the "json" placeholder.
+		reader := func([]rune) (interface{}, error) {
+			return parsed, nil
+		}
+		if err := strvals.ParseIntoFile(parts[0]+"=json", base, reader); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-json data: %s", err)
+		}
+	}
+	for _, value := range v.Values {
+		if err := strvals.ParseInto(value, base); err != nil {
+			return nil, fmt.Errorf("failed parsing --set data: %s", err)
+		}
+	}
+	for _, value := range v.StringValues {
+		if err := strvals.ParseIntoString(value, base); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-string data: %s", err)
+		}
+	}
+	for _, value := range v.FileValues {
+		reader := func(rs []rune) (interface{}, error) {
+			content, err := ioutil.ReadFile(string(rs))
+			return string(content), err
+		}
+		if err := strvals.ParseIntoFile(value, base, reader); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-file data: %s", err)
+		}
+	}
+	return base, nil
+}
+
+// servicesValues merges the values-files of each service, nested under its alias or chart name.
+// The later files of a service override the earlier ones.
+func (b *Boondoggle) servicesValues() (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for _, service := range b.Services {
+		serviceValues := map[string]interface{}{}
+		for _, file := range service.ValuesFiles {
+			fileValues, err := chartutil.ReadValuesFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("error reading the values-files of service %s: %s", service.Name, err)
+			}
+			serviceValues = mergeMaps(serviceValues, fileValues)
+		}
+		if len(service.ValuesFiles) > 0 {
+			merged = mergeMaps(merged, map[string]interface{}{service.GetHelmDepName(): serviceValues})
+		}
+	}
+	return merged, nil
+}
+
+// writeValuesFile writes values to a temporary values file.
+func writeValuesFile(v map[string]interface{}) (string, error) {
+	content, err := chartutil.Values(v).YAML()
+	if err != nil {
+		return "", err
+	}
+	file, err := ioutil.TempFile("", "boondoggle-values-*.yml")
+	if err != nil {
+		return "", fmt.Errorf("error writing the values file: %s", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error writing the values file: %s", err)
+	}
+	return file.Name(), nil
+}
+
+// mergeMaps merges b into a like helm merges its values files: the values of b win, and maps are merged recursively.
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeMaps(bv, v)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,338 @@
+package boondoggle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+func TestHelmValues(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(`helmVersion: 3
+services:
+  - name: service1
+    alias: api
+    states:
+      - state-name: default
+        helm-values:
+          - "localdev=true"
+          - key: replicas
+            value: 2
+            type: raw
+          - key: greeting
+            value: hello, world
+          - key: tls.cert
+            value: certs/tls.crt
+            type: file
+          - key: resources
+            value: '{"limits": {"cpu": "1"}}'
+            type: json
+          - key: tolerations
+            value:
+              - key: arch
+                values: [arm64]
+            type: json
+          - key: bad
+            type: yaml
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := UnmarshalConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []HelmValue{
+		{Key: "localdev", Value: "true"},
+		{Key: "replicas", Value: "2", Type: HelmValueRaw},
+		{Key: "greeting", Value: "hello, world", Type: HelmValueString},
+		{Key: "tls.cert", Value: "certs/tls.crt", Type: HelmValueFile},
+		{Key: "resources", Value: `{"limits": {"cpu": "1"}}`, Type: HelmValueJSON},
+		{Key: "tolerations", Value: `[{"key":"arch","values":["arm64"]}]`, Type: HelmValueJSON},
+		{Key: "bad", Type: "yaml"},
+	}
+	if !reflect.DeepEqual(config.Services[0].States[0].HelmValues, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, config.Services[0].States[0].HelmValues)
+	}
+	errs := checkConfig(config)
+	if len(errs) != 1 || errs[0].Path != "services[0].states[0].helm-values[6].type" {
+		t.Error("Expected an error for the unknown type, got:", errs)
+	}
+	config.HelmVersion = 2
+	errs = checkConfig(config)
+	if len(errs) != 3 || errs[1].Message != "helm value type json needs helm 3.10 or later (--set-json), set helmVersion: 3" {
+		t.Error("Expected an error for each json value with helm 2, got:", errs)
+	}
+
+	b := Boondoggle{Services: []Service{{Alias: "api", HelmValues: expected[:5]}}}
+	args, _, _, err := b.helmValueArgs(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedArgs := []string{
+		"--set-string", "api.localdev=true",
+		"--set", "api.replicas=2",
+		"--set-string", `api.greeting=hello\, world`,
+		"--set-file", "api.tls.cert=certs/tls.crt",
+		"--set-json", `api.resources={"limits": {"cpu": "1"}}`,
+	}
+	if !reflect.DeepEqual(args[2:], expectedArgs) {
+		t.Errorf("Expected %q, got %q", expectedArgs, args[2:])
+	}
+}
+
+func TestHelmValuesMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "values.yml"), []byte("api:\n  replicas: 1\n  resources:\n    requests:\n      cpu: 100m\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "tls.crt"), []byte("CERT"), 0644)
+
+	var vals helmValues
+	vals.ValueFiles = []string{filepath.Join(dir, "values.yml")}
+	for _, value := range []HelmValue{
+		{Key: "replicas", Value: "2", Type: HelmValueRaw},
+		{Key: "greeting", Value: "hello, world", Type: HelmValueString},
+		{Key: "cert", Value: filepath.Join(dir, "tls.crt"), Type: HelmValueFile},
+		{Key: "resources", Value: `{"limits": {"cpu": "1"}}`, Type: HelmValueJSON},
+	} {
+		vals.add(value.setArg("api."))
+	}
+	merged, err := vals.MergeValues(getter.Providers{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"api": map[string]interface{}{
+		"replicas":  int64(2),
+		"greeting":  "hello, world",
+		"cert":      "CERT",
+		"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "1"}},
+	}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+}
+
+func TestHelmValuesJSONKeys(t *testing.T) {
+	var vals helmValues
+	vals.add("--set", "api.list[1]=b")
+	vals.add("--set-json", `api.list[0]={"name": "a", "ports": [80, 443]}`)
+	vals.add("--set-json", `api.annotations.example\.com/role={"role": "api"}`)
+	merged, err := vals.MergeValues(getter.Providers{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// helm --set-json sets list indexes and keeps escaped dots in the key, like --set.
+	expected := map[string]interface{}{"api": map[string]interface{}{
+		"list": []interface{}{
+			map[string]interface{}{"name": "a", "ports": []interface{}{float64(80), float64(443)}},
+			"b",
+		},
+		"annotations": map[string]interface{}{"example.com/role": map[string]interface{}{"role": "api"}},
+	}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+}
+
+func TestHelmValuesDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		values string
+		err    string
+	}{
+		{"Test No Equals", `- "localdev"`, `helm value "localdev" has no '='`},
+		{"Test Float String", "- key: image.tag\n            value: 1.10", "the value 1.1 of helm value image.tag is not a yaml string"},
+		{"Test Bool File", "- key: cert\n            value: true\n            type: file", "the value true of helm value cert is not a yaml string"},
+		{"Test Map Raw", "- key: resources\n            value: {cpu: 1}\n            type: raw", "the value of helm value resources is a map or a list, which needs type json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			err := v.ReadConfig(strings.NewReader("services:\n  - name: service1\n    states:\n      - state-name: default\n        helm-values:\n          " + tt.values + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = UnmarshalConfig(v)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected the error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestServicesValuesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "base.yml"), []byte("image:\n  tag: latest\n  pullPolicy: Always\nreplicas: 1\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "local.yml"), []byte("image:\n  tag: dev\n"), 0644)
+
+	b, runner := newFakeBoondoggle()
+	b.HelmVersion = 3
+	b.Umbrella.Path = "/my-umbrella"
+	b.Umbrella.Files = []string{"local.yml"}
+	b.Services = []Service{
+		{Name: "service1", Alias: "api", ValuesFiles: []string{filepath.Join(dir, "base.yml"), filepath.Join(dir, "local.yml")}},
+		{Name: "service2", Chart: "worker-chart"},
+	}
+	_, err = b.DoUpgrade("mynamespace", "myrelease", false, false, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := runner.Calls[0].Args
+	if !reflect.DeepEqual(args[4:8], []string{"-f", "/my-umbrella/local.yml", "-f", args[7]}) {
+		t.Fatalf("Expected the generated values file after the umbrella files, got %q", args)
+	}
+	if _, err := os.Stat(args[7]); !os.IsNotExist(err) {
+		t.Error("Expected the generated values file to be removed after helm ran")
+	}
+
+	// The dry run prints the generated values file, which is removed once it returns.
+	out, err := b.DoUpgrade("mynamespace", "myrelease", true, false, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), ":\napi:\n  image:\n    pullPolicy: Always\n    tag: dev\n") {
+		t.Error("Expected the dry run to print the generated values file, got:", string(out))
+	}
+
+	b.Services[1].ValuesFiles = []string{filepath.Join(dir, "missing.yml")}
+	_, err = b.DoUpgrade("mynamespace", "myrelease", false, false, false, "")
+	if err == nil || !strings.Contains(err.Error(), "values-files of service service2") {
+		t.Error("Expected an error for the missing values file, got:", err)
+	}
+
+	b.Services[1].ValuesFiles = nil
+	merged, err := b.servicesValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := writeValuesFile(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+	content, _ := ioutil.ReadFile(file)
+	expected := "api:\n  image:\n    pullPolicy: Always\n    tag: dev\n  replicas: 1\n"
+	if string(content) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, content)
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boondoggle-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "local.yml"), []byte("replicas: 3\nlocaldev: false\n"), 0644)
+	defer os.Setenv("PWD", os.Getenv("PWD"))
+	os.Setenv("PWD", "/my-project")
+
+	b, runner := newFakeBoondoggle()
+	b.HelmVersion = 3
+	b.MergeValues = true
+	b.Umbrella.Path = "/my-umbrella"
+	b.Umbrella.Files = []string{"local.yml"}
+	b.Umbrella.Values = []string{"global.env=dev", "api.greeting=from umbrella"}
+	b.Services = []Service{{
+		Name:        "service1",
+		Alias:       "api",
+		Repository:  "localdev",
+		ValuesFiles: []string{filepath.Join(dir, "local.yml")},
+		HelmValues: []HelmValue{
+			{Key: "localdev", Value: "true", Type: HelmValueRaw},
+			{Key: "greeting", Value: "hello, world", Type: HelmValueString},
+		},
+	}}
+
+	out, err := b.DoUpgrade("mynamespace", "myrelease", true, false, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(out), "\n", 3)
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "[helm upgrade -i myrelease /my-umbrella -f /my-umbrella/local.yml -f "+lines[1][:len(lines[1])-1]+" --namespace") {
+		t.Fatal("Expected one generated values file and no --set flags, got:", string(out))
+	}
+	values, err := chartutil.ReadValues([]byte(lines[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := values["api"].(map[string]interface{})
+	// The service values override the values-files, and --set-string overrides --set like helm does.
+	if api["replicas"] != float64(3) || api["localdev"] != true || api["greeting"] != "hello, world" {
+		t.Error("Unexpected values for api:", api)
+	}
+	if _, ok := api["boondoggleCacheBust"].(string); !ok {
+		t.Error("Expected the cache buster to be a string, got:", api["boondoggleCacheBust"])
+	}
+	global := values["global"].(map[string]interface{})
+	if global["env"] != "dev" || global["projectLocation"] != "/my-project" {
+		t.Error("Unexpected global values:", global)
+	}
+
+	_, err = b.DoUpgrade("mynamespace", "myrelease", false, false, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := runner.Calls[0].Args
+	if args[6] != "-f" || !strings.HasSuffix(args[7], ".yml") {
+		t.Fatal("Expected the merged values file after the umbrella files, got:", args)
+	}
+	if _, err := os.Stat(args[7]); !os.IsNotExist(err) {
+		t.Error("Expected the merged values file to be removed after helm ran")
+	}
+}
+
+func TestMergeValuesJSONKeys(t *testing.T) {
+	b := Boondoggle{}
+	b.Umbrella.Values = []string{"api.list[1]=from umbrella"}
+	b.Services = []Service{{
+		Name:  "service1",
+		Alias: "api",
+		HelmValues: []HelmValue{
+			{Key: "list[0]", Value: `{"name": "a", "ports": [80, 443]}`, Type: HelmValueJSON},
+			{Key: `annotations.example\.com/role`, Value: `{"role": "api"}`, Type: HelmValueJSON},
+			{Key: `labels.example\.com/tier`, Value: "backend", Type: HelmValueString},
+		},
+	}}
+
+	final := map[bool]map[string]interface{}{}
+	for _, merge := range []bool{false, true} {
+		b.MergeValues = merge
+		_, valueOpts, cleanup, err := b.helmValueArgs(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Merged the way the helm CLI merges the -f and --set flags.
+		final[merge], err = valueOpts.MergeValues(getter.Providers{})
+		cleanup()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(final[true], final[false]) {
+		t.Errorf("Expected mergeValues to deploy the same values, got:\n%v\nwithout it:\n%v", final[true], final[false])
+	}
+	api := final[true]["api"].(map[string]interface{})
+	if list, ok := api["list"].([]interface{}); !ok || len(list) != 2 || list[1] != "from umbrella" {
+		t.Error("Expected the indexed keys to be set in the list, got:", api["list"])
+	}
+	if _, ok := api["annotations"].(map[string]interface{})["example.com/role"]; !ok {
+		t.Error("Expected the escaped dot to be kept in the key, got:", api["annotations"])
+	}
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	cloneLocalOnly bool
+	cloneDepth     int
+)
+
+// cloneCmd represents the clone command
+var cloneCmd = &cobra.Command{
+	Use:   "clone",
+	Short: "Clones the gitrepo of each service into its path",
+	Long: `This command will git clone every service that has a gitrepo into the path specified in boondoggle.yml.
+Checkouts that already exist are skipped and their clean/dirty status is reported.
+The gitref of the chosen state is checked out if one is specified.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Get a NewBoondoggle built from config.
+		b, err := newBoondoggle()
+		if err != nil {
+			return err
+		}
+
+		return b.CloneServices(cloneLocalOnly, cloneDepth)
+	},
+}
+
+func init() {
+	cloneCmd.Flags().BoolVar(&cloneLocalOnly, "local-only", false, "Only clone the services in a localdev state")
+
+	addDepthFlag(cloneCmd, &cloneDepth)
+
+	rootCmd.AddCommand(cloneCmd)
+}
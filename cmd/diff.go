@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+
+	"github.com/gmorse81/boondoggle/v3/boondoggle"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffRelease   string
+	diffNamespace string
+	diffSkipDepUp bool
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Shows what 'boondoggle up' would change in a release",
+	Long: `boondoggle diff renders the umbrella chart with the same requirements and values as 'boondoggle up' and
+	prints a diff of each kubernetes resource against the deployed release, followed by the dependency version and repository changes.
+	Nothing is built or installed: the requirements are written and the dependencies updated in a temporary copy of the umbrella chart,
+	which is removed afterwards, so the umbrella chart is left unchanged.
+	Requires helm 3.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Get a NewBoondoggle built from config.
+		b, err := newBoondoggle()
+		if err != nil {
+			return err
+		}
+
+		// Render from a temporary copy of the umbrella chart, so it is left unchanged.
+		tmp, err := ioutil.TempDir("", "boondoggle-diff-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		err = boondoggle.CopyUmbrella(&b, filepath.Join(tmp, "umbrella"))
+		if err != nil {
+			return err
+		}
+
+		// Build Requirements struct
+		r := boondoggle.BuildRequirements(b, viper.GetStringSlice("state-v-override"))
+
+		// Write the new requirements.yml or chart.yaml
+		err = boondoggle.WriteRequirements(r, b)
+		if err != nil {
+			return err
+		}
+
+		if !diffSkipDepUp {
+			// Add any helm repos that are not already added.
+			err = b.AddHelmRepos()
+			if err != nil {
+				return err
+			}
+
+			// Run helm dep up
+			err = b.DepUp()
+			if err != nil {
+				return err
+			}
+		}
+
+		out, _, err := b.Diff(diffNamespace, diffRelease, viper.GetBool("helm-secrets"), r)
+		if err != nil {
+			return err
+		}
+		fmt.Print(out)
+		return nil
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffRelease, "release", "", "The helm release name")
+	diffCmd.MarkFlagRequired("release")
+
+	diffCmd.Flags().StringVar(&diffNamespace, "namespace", "", "The kubernetes namespace of this release")
+
+	diffCmd.Flags().BoolVar(&diffSkipDepUp, "fast", false, "Skip adding the helm repos and downloading dependencies")
+
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"github.com/spf13/cobra"
+)
+
+var downRelease string
+var downNamespace string
+var downTillerNamespace string
+var downTLS bool
+var deleteNamespace bool
+var deletePullSecret bool
+var removeImages bool
+
+// downCmd represents the down command
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Uninstalls the helm release and optionally cleans up what 'boondoggle up' created",
+	Long: `boondoggle down will uninstall the helm release.
+	Flags can be used to also remove the namespace, the image pull secret and the locally built images.
+	With --dry-run, the commands that would have been run are printed.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Get a NewBoondoggle built from config.
+		b, err := newBoondoggle()
+		if err != nil {
+			return err
+		}
+
+		out, err := b.DoUninstall(downNamespace, downRelease, viper.GetBool("dry-run"), downTLS, downTillerNamespace)
+		if err != nil {
+			return fmt.Errorf("helm uninstall command reported error: %s", string(out))
+		}
+		b.L.Print(string(out))
+
+		if deletePullSecret {
+			err = b.DeleteImagePullSecret(downNamespace, viper.GetBool("dry-run"))
+			if err != nil {
+				return err
+			}
+		}
+
+		if deleteNamespace {
+			err = b.DeleteNamespace(downNamespace, viper.GetBool("dry-run"))
+			if err != nil {
+				return err
+			}
+		}
+
+		if removeImages {
+			err = b.RemoveLocalImages(viper.GetBool("dry-run"))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	downCmd.Flags().StringVar(&downRelease, "release", "", "The helm release name")
+	downCmd.MarkFlagRequired("release")
+
+	downCmd.Flags().StringVar(&downNamespace, "namespace", "", "The kubernetes namespace of this release")
+
+	downCmd.Flags().StringVar(&downTillerNamespace, "tiller-namespace", "kube-system", "The namespace where tiller resides")
+
+	downCmd.Flags().BoolVar(&downTLS, "tls", false, "Use TLS with tiller - requires key and certs in your helm home dir")
+
+	downCmd.Flags().BoolVar(&deleteNamespace, "delete-namespace", false, "Delete the namespace after uninstalling the release")
+
+	downCmd.Flags().BoolVar(&deletePullSecret, "delete-pull-secret", false, "Delete the image pull secret named by pull-secrets-name")
+
+	downCmd.Flags().BoolVar(&removeImages, "remove-images", false, "Remove the images built by container-build for the services in a localdev state")
+
+	rootCmd.AddCommand(downCmd)
+}
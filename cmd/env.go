@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gmorse81/boondoggle/v3/boondoggle"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Shows the umbrella environments of boondoggle.yml",
+}
+
+// envShowCmd represents the env show command
+var envShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Prints an umbrella environment with the files, values and addtlHelmFlags of the environments it extends",
+	Long: `boondoggle env show prints the named umbrella environment as boondoggle up uses it: the files, values and addtlHelmFlags
+	of the environments it extends come first, in the order of the extends chain. Environment variables are not replaced.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Problems elsewhere in the config do not stop the environment from being shown.
+		_, config, err := newBoondoggleAndConfig()
+		if _, ok := err.(boondoggle.ConfigErrors); err != nil && !ok {
+			return err
+		}
+
+		env, err := boondoggle.ResolveUmbrellaEnvironment(args[0], config)
+		if err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(env)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	},
+}
+
+func init() {
+	envCmd.AddCommand(envShowCmd)
+	rootCmd.AddCommand(envCmd)
+}
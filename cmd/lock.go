@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gmorse81/boondoggle/v3/boondoggle"
+
+	"github.com/spf13/cobra"
+)
+
+var lockUpdate bool
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Resolves the version of every dependency and writes them to boondoggle.lock",
+	Long: `boondoggle lock resolves the version range of every state of every service that is not localdev against the index.yaml
+	of its helm repo, and writes the versions to boondoggle.lock next to boondoggle.yml.
+	'boondoggle up' then deploys the locked versions, unless they are overridden with --state-v-override.
+	Versions that are already locked are kept, use --update to resolve them again.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Get a NewBoondoggle built from config.
+		b, config, err := newBoondoggleAndConfig()
+		if err != nil {
+			return err
+		}
+
+		lock, err := b.ResolveLock(config, b.Lock, lockUpdate)
+		if err != nil {
+			return err
+		}
+		err = boondoggle.WriteLock(stateDir(), lock)
+		if err != nil {
+			return err
+		}
+		printLock(lock)
+		return nil
+	},
+}
+
+// printLock prints the resolved version of each locked dependency.
+func printLock(lock boondoggle.Lock) {
+	for _, dep := range lock.Dependencies {
+		fmt.Printf("%s: %s %s from %s -> %s\n", dep.Service, dep.Chart, dep.Constraint, dep.Repository, dep.Version)
+	}
+}
+
+func init() {
+	lockCmd.Flags().BoolVar(&lockUpdate, "update", false, "Resolve the versions that are already locked again")
+
+	rootCmd.AddCommand(lockCmd)
+}
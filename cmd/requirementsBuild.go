@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"log"
-	"os"
-
 	"github.com/gmorse81/boondoggle/v3/boondoggle"
 
 	"github.com/spf13/cobra"
@@ -11,6 +8,7 @@ import (
 )
 
 var fastReq bool
+var reqOutDir string
 
 // requirementsBuildCmd represents the requirementsBuild command
 var requirementsBuildCmd = &cobra.Command{
@@ -22,15 +20,24 @@ No deployment or container builds will occur.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		// Get a NewBoondoggle built from config.
-		var config boondoggle.RawBoondoggle
-		viper.Unmarshal(&config)
-		b := boondoggle.NewBoondoggle(config, viper.GetString("environment"), viper.GetString("set-state-all"), viper.GetStringSlice("service-state"), map[string]string{}, log.New(os.Stdout, "", 0), viper.GetBool("verbose"), viper.GetBool("supersecret"))
+		b, err := newBoondoggle()
+		if err != nil {
+			return err
+		}
+
+		// Work on a copy of the umbrella chart instead of the working tree.
+		if reqOutDir != "" {
+			err = boondoggle.CopyUmbrella(&b, reqOutDir)
+			if err != nil {
+				return err
+			}
+		}
 
 		//Build requirements.yml
 		r := boondoggle.BuildRequirements(b, viper.GetStringSlice("state-v-override"))
 
 		// Write the new requirements.yml
-		err := boondoggle.WriteRequirements(r, b)
+		err = boondoggle.WriteRequirements(r, b)
 		if err != nil {
 			return err
 		}
@@ -42,6 +49,13 @@ No deployment or container builds will occur.`,
 				return err
 			}
 
+			if viper.GetBool("update-repos") {
+				err = b.UpdateHelmRepos()
+				if err != nil {
+					return err
+				}
+			}
+
 			// Run helm dep up
 			err = b.DepUp()
 			if err != nil {
@@ -57,5 +71,7 @@ func init() {
 	requirementsBuildCmd.Flags().BoolVar(&fastReq, "fast", false, "Build the requirements file, but do not download the dependencies")
 	viper.BindPFlag("fast", requirementsBuildCmd.Flags().Lookup("fast"))
 
+	requirementsBuildCmd.Flags().StringVar(&reqOutDir, "out-dir", "", "Copy the umbrella chart to this directory and build the requirements there, leaving the umbrella chart unchanged")
+
 	rootCmd.AddCommand(requirementsBuildCmd)
 }
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/gmorse81/boondoggle/v3/boondoggle"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// resumeOtherFlags are the flags saved in ReleaseState.Flags. Flags that only change how "up" runs,
+// like --dry-run or --skip-docker, are not saved.
+var resumeOtherFlags = []string{"helm-secrets", "tls", "tiller-namespace", "helm-backend", "merge-values", "out-dir", "isolated"}
+
+// stateDir is the directory of boondoggle.yml, where the .boondoggle directory is kept.
+func stateDir() string {
+	if viper.ConfigFileUsed() == "" {
+		return "."
+	}
+	return filepath.Dir(viper.ConfigFileUsed())
+}
+
+// releaseStateFromFlags records the flags that were given on the command line, and the environment variables
+// boondoggle.yml used.
+func releaseStateFromFlags(cmd *cobra.Command, usedEnv map[string]string) boondoggle.ReleaseState {
+	flags := cmd.Flags()
+	state := boondoggle.ReleaseState{Release: release, ExtraEnv: usedEnv, Flags: map[string]string{}}
+	if flags.Changed("namespace") {
+		state.Namespace = namespace
+	}
+	if flags.Changed("environment") {
+		state.Environment = umbrellaEnv
+	}
+	if flags.Changed("profile") {
+		state.Profile = profile
+	}
+	if flags.Changed("set-state-all") {
+		state.SetStateAll = setStateAll
+	}
+	if flags.Changed("service-state") {
+		state.ServiceStates = serviceState
+	}
+	if flags.Changed("state-v-override") {
+		state.StateVersionOverrides = stateValueOverride
+	}
+	for _, name := range resumeOtherFlags {
+		if flags.Changed(name) {
+			state.Flags[name] = flags.Lookup(name).Value.String()
+		}
+	}
+	return state
+}
+
+// savedFlagsChanged tells if a flag that is saved in ReleaseState, other than --release, was given on the command line.
+func savedFlagsChanged(cmd *cobra.Command) bool {
+	flags := cmd.Flags()
+	for _, name := range append([]string{"namespace", "environment", "profile", "set-state-all", "service-state", "state-v-override"}, resumeOtherFlags...) {
+		if flags.Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyReleaseState sets the flags saved in state that were not given on the command line.
+func applyReleaseState(cmd *cobra.Command, state boondoggle.ReleaseState) error {
+	flags := cmd.Flags()
+	settings := map[string][]string{
+		"release":          {state.Release},
+		"namespace":        {state.Namespace},
+		"environment":      {state.Environment},
+		"profile":          {state.Profile},
+		"set-state-all":    {state.SetStateAll},
+		"service-state":    state.ServiceStates,
+		"state-v-override": state.StateVersionOverrides,
+	}
+	for name, value := range state.Flags {
+		settings[name] = []string{value}
+	}
+	for name, values := range settings {
+		if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			continue
+		}
+		err := setUnchangedFlag(flags, name, values)
+		if err != nil {
+			return err
+		}
+	}
+	// The environment variables that are set now win over the saved ones.
+	for name, value := range state.ExtraEnv {
+		if os.Getenv(name) == "" {
+			extraEnv[name] = value
+		}
+	}
+	return nil
+}
+
+// setUnchangedFlag sets a flag that was not given on the command line.
+func setUnchangedFlag(flags *pflag.FlagSet, name string, values []string) error {
+	flag := flags.Lookup(name)
+	if flag == nil || flag.Changed {
+		return nil
+	}
+	if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+		flag.Changed = true
+		return sliceValue.Replace(values)
+	}
+	return flags.Set(name, values[0])
+}
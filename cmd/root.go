@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
 
+	"github.com/gmorse81/boondoggle/v3/boondoggle"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -30,6 +33,13 @@ var (
 	useSecrets         bool
 	verbose            bool
 	superSecret        bool
+	helmBackend        string
+	mergeValues        bool
+	updateRepos        bool
+	profile            string
+	nonInteractive     bool
+	// extraEnv is passed to NewBoondoggle. It holds the saved environment variables of up --resume.
+	extraEnv = map[string]string{}
 )
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -53,6 +63,9 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&umbrellaEnv, "environment", "e", "default", "Selects the umbrella environment. Defaults to the environment with name: default in the boondoggle.yml file.")
 	viper.BindPFlag("environment", rootCmd.PersistentFlags().Lookup("environment"))
 
+	rootCmd.PersistentFlags().StringVarP(&profile, "profile", "p", "", "Selects a profile from boondoggle.yml, setting the state of its services and its environment. -s and -e still win.")
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+
 	rootCmd.PersistentFlags().StringSliceVarP(&stateValueOverride, "state-v-override", "o", []string{""}, "Override a services's version for the state specified. eg. my-service=1.0.0")
 	viper.BindPFlag("state-v-override", rootCmd.PersistentFlags().Lookup("state-v-override"))
 
@@ -73,6 +86,18 @@ func init() {
 
 	rootCmd.PersistentFlags().BoolVar(&superSecret, "supersecret", false, "This flag will use the --debug flag on all the helm commands. OUTPUTS EVERYTHING. SECRETS, PASSWORDS, CERTIFICATES WILL BE PRINTED TO THE SCREEN.")
 	viper.BindPFlag("supersecret", rootCmd.PersistentFlags().Lookup("supersecret"))
+
+	rootCmd.PersistentFlags().StringVar(&helmBackend, "helm-backend", "", "Run helm with the helm binary (cli) or in-process with the Helm v3 SDK (sdk). Overrides helmBackend in boondoggle.yml.")
+	viper.BindPFlag("helm-backend", rootCmd.PersistentFlags().Lookup("helm-backend"))
+
+	rootCmd.PersistentFlags().BoolVar(&mergeValues, "merge-values", false, "Pass the values of the services and the umbrella to helm as one generated values file instead of --set flags. Same as mergeValues in boondoggle.yml.")
+	viper.BindPFlag("merge-values", rootCmd.PersistentFlags().Lookup("merge-values"))
+
+	rootCmd.PersistentFlags().BoolVar(&updateRepos, "update-repos", false, "Runs helm repo update for the helm repos in boondoggle.yml after adding them.")
+	viper.BindPFlag("update-repos", rootCmd.PersistentFlags().Lookup("update-repos"))
+
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", false, "Never prompt for credentials, fail with the missing config key instead. On when stdin is not a terminal.")
+	viper.BindPFlag("non-interactive", rootCmd.PersistentFlags().Lookup("non-interactive"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -91,3 +116,54 @@ func initConfig() {
 		fmt.Println(err)
 	}
 }
+
+// newBoondoggle builds a Boondoggle from the config file and the global flags.
+// Problems with the config are returned with their line numbers in the config file.
+func newBoondoggle() (boondoggle.Boondoggle, error) {
+	b, _, err := newBoondoggleAndConfig()
+	return b, err
+}
+
+// newBoondoggleAndConfig is newBoondoggle that also returns the config that the Boondoggle was built from.
+func newBoondoggleAndConfig() (boondoggle.Boondoggle, boondoggle.RawBoondoggle, error) {
+	// Only the config files are unmarshaled, the global viper also holds the flags.
+	configViper := viper.New()
+	sources := boondoggle.ConfigSources{}
+	if viper.ConfigFileUsed() != "" {
+		var err error
+		configViper, sources, err = boondoggle.LoadConfig(viper.ConfigFileUsed())
+		if err != nil {
+			return boondoggle.Boondoggle{}, boondoggle.RawBoondoggle{}, err
+		}
+	}
+	config, err := boondoggle.UnmarshalConfig(configViper)
+	if err != nil {
+		return boondoggle.Boondoggle{}, config, err
+	}
+	if viper.GetString("helm-backend") != "" {
+		config.HelmBackend = viper.GetString("helm-backend")
+	}
+	if viper.GetBool("merge-values") {
+		config.MergeValues = true
+	}
+	// The environment of a profile is only used when -e was not given.
+	environment := viper.GetString("environment")
+	if viper.GetString("profile") != "" && !rootCmd.PersistentFlags().Changed("environment") {
+		environment = ""
+	}
+	b, err := boondoggle.NewBoondoggle(config, environment, viper.GetString("profile"), viper.GetString("set-state-all"), viper.GetStringSlice("service-state"), extraEnv, log.New(os.Stdout, "", 0), viper.GetBool("verbose"), viper.GetBool("supersecret"))
+	if err == nil {
+		err = b.CheckStateVersionOverrides(viper.GetStringSlice("state-v-override"))
+	}
+	if configErrors, ok := err.(boondoggle.ConfigErrors); ok {
+		return b, config, configErrors.AddSources(viper.ConfigFileUsed(), sources)
+	}
+	if err != nil {
+		return b, config, err
+	}
+	if viper.GetBool("non-interactive") || !boondoggle.IsInteractive() {
+		b.P = boondoggle.NonInteractivePrompter{}
+	}
+	b.Lock, err = boondoggle.LoadLock(stateDir())
+	return b, config, err
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusRelease   string
+	statusNamespace string
+	statusOutput    string
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the deployed state of each service of a release",
+	Long: `boondoggle status reads the deployed helm release and shows, for each service, the state chosen by the flags,
+	the repository and version that were deployed, whether the service was deployed as localdev and how many of its pods are ready.
+	Requires helm 3.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if statusOutput != "table" && statusOutput != "json" {
+			return fmt.Errorf("unknown --output %s, use table or json", statusOutput)
+		}
+
+		// Get a NewBoondoggle built from config.
+		b, err := newBoondoggle()
+		if err != nil {
+			return err
+		}
+
+		status, err := b.Status(statusNamespace, statusRelease)
+		if err != nil {
+			return err
+		}
+
+		if statusOutput == "json" {
+			out, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+		fmt.Print(status.Table())
+		return nil
+	},
+}
+
+func init() {
+	statusCmd.Flags().StringVar(&statusRelease, "release", "", "The helm release name")
+	statusCmd.MarkFlagRequired("release")
+
+	statusCmd.Flags().StringVar(&statusNamespace, "namespace", "", "The kubernetes namespace of this release")
+
+	statusCmd.Flags().StringVar(&statusOutput, "output", "table", "The output format, table or json")
+
+	rootCmd.AddCommand(statusCmd)
+}
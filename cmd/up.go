@@ -2,8 +2,7 @@ package cmd
 
 import (
 	"fmt"
-	"log"
-	"os"
+	"path/filepath"
 
 	"github.com/spf13/viper"
 
@@ -17,26 +16,80 @@ var release string
 var tillerNamespace string
 var tls bool
 var skipDepUp bool
+var skipClone bool
+var parallel int
+var resume bool
+var updateLock bool
+var upDepth int
 
 // upCmd represents the up command
 var upCmd = &cobra.Command{
 	Use:   "up",
 	Short: "Runs 'helm upgrade --install' with config based on flags and the contents of boondoggle.yml",
 	Long: `boondoggle up with no extra flags will configure your defaults and deploy using helm.
-	Flags can be used to change configuration based on your needs.`,
+	Flags can be used to change configuration based on your needs.
+	The flags of each release are saved in .boondoggle/releases, and --resume runs up again with them.
+	--release with none of the saved flags does the same for that release.`,
 	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		// Replay the saved flags of the release, or of the last release if --release was not given.
+		// --release alone also replays the saved flags of that release.
+		if resume || (release != "" && !savedFlagsChanged(cmd) && boondoggle.ReleaseStateExists(stateDir(), release)) {
+			state, err := boondoggle.LoadReleaseState(stateDir(), release)
+			if err != nil {
+				return err
+			}
+			err = applyReleaseState(cmd, state)
+			if err != nil {
+				return err
+			}
+		}
+		if release == "" {
+			return fmt.Errorf(`required flag(s) "release" not set`)
+		}
+
 		// Get a NewBoondoggle built from config.
-		var config boondoggle.RawBoondoggle
-		viper.Unmarshal(&config)
-		b := boondoggle.NewBoondoggle(config, viper.GetString("environment"), viper.GetString("set-state-all"), viper.GetStringSlice("service-state"), map[string]string{}, log.New(os.Stdout, "", 0), viper.GetBool("verbose"), viper.GetBool("supersecret"))
+		b, config, err := newBoondoggleAndConfig()
+		if err != nil {
+			return err
+		}
+
+		// Resolve the dependency versions again and update boondoggle.lock. A dry run only prints them.
+		if updateLock {
+			b.Lock, err = b.ResolveLock(config, b.Lock, true)
+			if err != nil {
+				return err
+			}
+			if viper.GetBool("dry-run") {
+				printLock(b.Lock)
+			} else {
+				err = boondoggle.WriteLock(stateDir(), b.Lock)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Clone the source projects of localdev services that are not checked out yet.
+		if !skipClone {
+			err = b.CloneServices(true, upDepth)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Build in a copy of the umbrella chart with --out-dir or --isolated.
+		err = copyUmbrella(cmd, &b, release)
+		if err != nil {
+			return err
+		}
 
 		// Build Requirements struct
 		r := boondoggle.BuildRequirements(b, viper.GetStringSlice("state-v-override"))
 
 		// Write the new requirements.yml or chart.yaml
-		err := boondoggle.WriteRequirements(r, b)
+		err = boondoggle.WriteRequirements(r, b)
 		if err != nil {
 			return err
 		}
@@ -47,19 +100,22 @@ var upCmd = &cobra.Command{
 			return err
 		}
 
+		if viper.GetBool("update-repos") {
+			err = b.UpdateHelmRepos()
+			if err != nil {
+				return err
+			}
+		}
+
 		// Add the imagePullSecrets using kubectl
-		err = b.AddImagePullSecret(viper.GetString("namespace"))
+		err = b.AddImagePullSecret(viper.GetString("namespace"), viper.GetBool("dry-run"))
 		if err != nil {
 			return err
 		}
 
 		// Build the containers that need to be built.
 		if !skipDocker {
-			err = b.DoPreDeploySteps()
-			if err != nil {
-				return err
-			}
-			err = b.DoBuild()
+			err = b.DoLocalBuilds(viper.GetInt("parallel"))
 			if err != nil {
 				return err
 			}
@@ -75,11 +131,21 @@ var upCmd = &cobra.Command{
 
 		// Run the helm upgrade --install command
 		out, err := b.DoUpgrade(viper.GetString("namespace"), viper.GetString("release"), viper.GetBool("dry-run"), viper.GetBool("helm-secrets"), viper.GetBool("tls"), viper.GetString("tiller-namespace"))
+		if err != nil && len(out) == 0 {
+			return err
+		}
 		if err != nil {
 			return fmt.Errorf("helm upgrade command reported error: %s", string(out))
 		}
 		b.L.Print(string(out))
 
+		if !viper.GetBool("dry-run") {
+			err = boondoggle.SaveReleaseState(stateDir(), releaseStateFromFlags(cmd, b.UsedEnv()))
+			if err != nil {
+				b.L.Print(boondoggle.Format(boondoggle.Yellow, err.Error()))
+			}
+		}
+
 		if !skipDocker {
 			err = b.DoPostDeploySteps()
 			if err != nil {
@@ -96,8 +162,7 @@ var upCmd = &cobra.Command{
 }
 
 func init() {
-	upCmd.Flags().StringVar(&release, "release", "", "The helm release name")
-	upCmd.MarkFlagRequired("release")
+	upCmd.Flags().StringVar(&release, "release", "", "The helm release name. Required unless --resume is used")
 	viper.BindPFlag("release", upCmd.Flags().Lookup("release"))
 
 	upCmd.Flags().StringVar(&namespace, "namespace", "", "The kubernetes namespace of this release")
@@ -112,5 +177,43 @@ func init() {
 	upCmd.Flags().BoolVar(&skipDepUp, "fast", false, "Recklessly skip downloading dependencies. Faster, but you may end up installing out-of-date dependencies")
 	viper.BindPFlag("fast", upCmd.Flags().Lookup("fast"))
 
+	upCmd.Flags().BoolVar(&skipClone, "skip-clone", false, "Skip cloning the gitrepo of localdev services that are not checked out")
+	viper.BindPFlag("skip-clone", upCmd.Flags().Lookup("skip-clone"))
+
+	upCmd.Flags().IntVar(&parallel, "parallel", 1, "Run the preDeploySteps and container-build of up to this many localdev services at the same time")
+	viper.BindPFlag("parallel", upCmd.Flags().Lookup("parallel"))
+
+	upCmd.Flags().BoolVar(&resume, "resume", false, "Use the flags saved by the last up of --release, or of the last release. Flags given on the command line still win")
+
+	upCmd.Flags().BoolVar(&updateLock, "update", false, "Resolve the versions in boondoggle.lock again before deploying, instead of using the locked ones. With --dry-run, boondoggle.lock is not written")
+
+	addDepthFlag(upCmd, &upDepth)
+
+	addOutDirFlags(upCmd)
+
 	rootCmd.AddCommand(upCmd)
 }
+
+// addDepthFlag adds the --depth flag of the commands that clone the services.
+func addDepthFlag(cmd *cobra.Command, depth *int) {
+	cmd.Flags().IntVar(depth, "depth", 0, "Make shallow clones of service gitrepos with this many commits. 0 clones the full history.")
+}
+
+// addOutDirFlags adds the flags of copyUmbrella to cmd.
+func addOutDirFlags(cmd *cobra.Command) {
+	cmd.Flags().String("out-dir", "", "Copy the umbrella chart to this directory and deploy from there, leaving the umbrella chart unchanged")
+	cmd.Flags().Bool("isolated", false, "Like --out-dir, with .boondoggle/build/<release> next to boondoggle.yml as the directory")
+}
+
+// copyUmbrella points b at a copy of the umbrella chart when the --out-dir or --isolated flag of cmd is used.
+func copyUmbrella(cmd *cobra.Command, b *boondoggle.Boondoggle, release string) error {
+	dir, _ := cmd.Flags().GetString("out-dir")
+	isolated, _ := cmd.Flags().GetBool("isolated")
+	if dir == "" && isolated {
+		dir = filepath.Join(stateDir(), boondoggle.StateDir, "build", release)
+	}
+	if dir == "" {
+		return nil
+	}
+	return boondoggle.CopyUmbrella(b, dir)
+}
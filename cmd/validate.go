@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gmorse81/boondoggle/v3/boondoggle"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks boondoggle.yml and the given flags for problems",
+	Long: `This command will build the config for the given environment and service states and print every problem found,
+with the line number in boondoggle.yml when there is one. Nothing is written, installed or built.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := newBoondoggle()
+		if configErrors, ok := err.(boondoggle.ConfigErrors); ok {
+			for _, configError := range configErrors {
+				if configError.File == "" {
+					configError.File = viper.ConfigFileUsed()
+				}
+				fmt.Println(boondoggle.Format(boondoggle.Red, configError.Error()))
+			}
+			return fmt.Errorf("found %d problem(s)", len(configErrors))
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(boondoggle.Format(boondoggle.Green, viper.ConfigFileUsed()+" is valid"))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}